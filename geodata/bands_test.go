@@ -0,0 +1,55 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"strconv"
+	"testing"
+)
+
+// TestBanded places records at known distances due north
+// of the search location into the expected bands
+func TestBanded(t *testing.T) {
+	// 1 degree of latitude is KmPerDegree km
+	kmNorth := func(km float64) string {
+		return strconv.FormatFloat(51.0+km/KmPerDegree, 'f', -1, 64)
+	}
+	geo := populateLines([][]string{
+		{"500m", "", "", "", "0", kmNorth(0.5), "0"},
+		{"999m", "", "", "", "0", kmNorth(0.999), "0"},
+		{"1.001km", "", "", "", "0", kmNorth(1.001), "0"},
+		{"4km", "", "", "", "0", kmNorth(4), "0"},
+		{"30km", "", "", "", "0", kmNorth(30), "0"},
+	})
+	res, _ := geo.FindE(51.0, 0, 0, 10, "km", "test")
+	bands, err := res.Banded([]float64{1, 5, 20})
+	if err != nil {
+		t.Fatalf("Banding failed: %s", err)
+	}
+	expect := map[int][]string{
+		0: {"500m", "999m"},
+		1: {"1.001km", "4km"},
+		3: {"30km"},
+	}
+	if len(bands) != len(expect) {
+		t.Errorf("Got %d bands, expected %d", len(bands), len(expect))
+	}
+	for band, ids := range expect {
+		if len(bands[band]) != len(ids) {
+			t.Errorf("Band %d has %d results, expected %d", band, len(bands[band]), len(ids))
+			continue
+		}
+		for i, id := range ids {
+			if bands[band][i].ID != id {
+				t.Errorf("Band %d result %d is %s, expected %s", band, i, bands[band][i].ID, id)
+			}
+		}
+	}
+
+	if _, err := res.Banded([]float64{5, 1}); err == nil {
+		t.Errorf("Expected an error banding with descending thresholds")
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// TestFlagsMask filters on a bit in the second word of 128 bit bitmaps,
+// alongside records with ordinary 64 bit bitmaps
+func TestFlagsMask(t *testing.T) {
+	geo := populateLines([][]string{
+		{"narrow", "", "", "", "3", "51.5", "-0.1"},
+		{"second", "", "", "", "0x1,0x80", "51.51", "-0.1"},
+		{"first", "", "", "", "0x2,0", "51.52", "-0.1"},
+		{"both", "", "", "", "2, 0x81", "51.53", "-0.1"},
+	})
+	// bit 71 is bit 7 of the second word
+	res := geo.Find(51.5, -0.1, 0, 10, "km", "test", WithFlagsMask(Flags{0, 1 << 7}))
+	if got := resultIDs(res); !slices.Equal(got, []string{"second", "both"}) {
+		t.Errorf("Got %v with bit 71", got)
+	}
+	if !reflect.DeepEqual(res[0].Bitmaps, Flags{0x1, 0x80}) || res[0].Bitmap != 1 {
+		t.Errorf("Got bitmaps %v and bitmap %d for the second record", res[0].Bitmaps, res[0].Bitmap)
+	}
+	// changing a result's bitmaps leaves the record's alone
+	res[0].Bitmaps[1] = 0
+	if rec, _ := geo.Record("second"); rec.Bitmaps[1] != 0x80 {
+		t.Errorf("Changing a result's bitmaps changed the record's to %v", rec.Bitmaps)
+	}
+	// bit 64, with the bitmask filtering the first word as usual
+	res = geo.Find(51.5, -0.1, 2, 10, "km", "test", WithFlagsMask(Flags{0, 1}))
+	if got := resultIDs(res); !slices.Equal(got, []string{"both"}) {
+		t.Errorf("Got %v with bit 1 and bit 64", got)
+	}
+	// requiring and excluding bit 71 alongside bit 0
+	res = geo.Find(51.5, -0.1, 0, 10, "km", "test", WithRequireFlags(Flags{1, 1 << 7}))
+	if got := resultIDs(res); !slices.Equal(got, []string{"second"}) {
+		t.Errorf("Got %v requiring bits 0 and 71", got)
+	}
+	res = geo.Find(51.5, -0.1, 0, 10, "km", "test", WithExcludeFlags(Flags{0, 1 << 7}))
+	if got := resultIDs(res); !slices.Equal(got, []string{"narrow", "first"}) {
+		t.Errorf("Got %v excluding bit 71", got)
+	}
+	// a mask of the first word alone matches narrow bitmaps too
+	res = geo.Find(51.5, -0.1, 0, 10, "km", "test", WithFlagsMask(Flags{2}))
+	if got := resultIDs(res); !slices.Equal(got, []string{"narrow", "first", "both"}) {
+		t.Errorf("Got %v with bit 1", got)
+	}
+	// a zero mask doesn't filter, like a zero bitmask
+	for _, mask := range []Flags{{0, 0}, {}} {
+		res = geo.Find(51.5, -0.1, 0, 10, "km", "test", WithFlagsMask(mask))
+		if len(res) != 4 {
+			t.Errorf("Got %v with the zero mask %v instead of all 4 records", resultIDs(res), mask)
+		}
+	}
+	// the trailing zero word is dropped, leaving an ordinary bitmap
+	if rec, _ := geo.Record("first"); rec.Bitmaps != nil || rec.Bitmap != 2 {
+		t.Errorf("Got bitmaps %v and bitmap %d for the first record", rec.Bitmaps, rec.Bitmap)
+	}
+	if rec, _ := geo.Record("narrow"); rec.Bitmaps != nil || rec.Bitmap != 3 {
+		t.Errorf("Got bitmaps %v and bitmap %d for the narrow record", rec.Bitmaps, rec.Bitmap)
+	}
+
+	// the wide bitmaps export in the format they're imported in
+	var buf bytes.Buffer
+	if err := geo.ExportCSV(&buf); err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	reimported := new(GeoData)
+	if err := reimported.ImportReader(&buf, "test"); err != nil {
+		t.Fatalf("Re-import failed: %s", err)
+	}
+	for i, rec := range reimported.records {
+		if !reflect.DeepEqual(rec.Bitmaps, geo.records[i].Bitmaps) || rec.Bitmap != geo.records[i].Bitmap {
+			t.Errorf("Re-imported bitmaps %v instead of %v", rec.Bitmaps, geo.records[i].Bitmaps)
+		}
+	}
+}
+
+// TestParseFlags parses hexadecimal words, and tests their bits
+func TestParseFlags(t *testing.T) {
+	flags, err := ParseFlags("0x1, FF ,0X8000000000000000")
+	if err != nil {
+		t.Fatalf("ParseFlags failed - %s", err)
+	}
+	if !reflect.DeepEqual(flags, Flags{1, 0xff, 1 << 63}) || flags.String() != "0x1,0xff,0x8000000000000000" {
+		t.Errorf("Parsed %v", flags)
+	}
+	for bit, set := range map[int]bool{0: true, 1: false, 64: true, 71: true, 72: false, 191: true, 192: false, -1: false} {
+		if flags.Has(bit) != set {
+			t.Errorf("Expected bit %d set to be %v", bit, set)
+		}
+	}
+	if flags.Intersects(Flags{2, 0x100}) || !flags.Intersects(Flags{2, 0x101}) {
+		t.Errorf("Intersections of %v are wrong", flags)
+	}
+	if !flags.Contains(Flags{1, 0x81}) || flags.Contains(Flags{3}) || flags.Contains(Flags{1, 0, 0, 1}) || !flags.Contains(Flags{1, 0, 0, 0}) {
+		t.Errorf("Containment of %v is wrong", flags)
+	}
+	if common := flags.Common(Flags{3, 0x1ff, 1 << 63}); common != 10 {
+		t.Errorf("Counted %d bits in common with %v instead of 10", common, flags)
+	}
+	for _, invalid := range []string{"", "0x1,", "0x1,0xg", "0x10000000000000000"} {
+		if _, err := ParseFlags(invalid); err == nil {
+			t.Errorf("Expected an error parsing '%s'", invalid)
+		}
+	}
+}
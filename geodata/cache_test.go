@@ -0,0 +1,53 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"testing"
+)
+
+// TestPeanoCache checks cached peano codes match freshly calculated ones,
+// and that the cache doesn't grow beyond its size
+func TestPeanoCache(t *testing.T) {
+	geo, err := NewGeoData(WithPeanoCache(100))
+	if err != nil {
+		t.Fatalf("Failed to create a GeoData - %s", err)
+	}
+	// search everywhere twice, so the second pass is served from the cache
+	for range 2 {
+		for lat := -90.0; lat <= 90; lat += 7.654321 {
+			for lon := -180.0; lon <= 180; lon += 11.123456 {
+				peano1, peano2 := geo.searchPeanos(lat, lon)
+				if peano1 != CalcPeano(lat, lon) || peano2 != CalcPeanoOffset(lat, lon) {
+					t.Fatalf("Cached peanos %d, %d at %0.6f, %0.6f don't match %d, %d", peano1, peano2, lat, lon, CalcPeano(lat, lon), CalcPeanoOffset(lat, lon))
+				}
+			}
+		}
+	}
+	if len(geo.peanoCache.items) != 100 || geo.peanoCache.order.Len() != 100 {
+		t.Errorf("Peano cache grew to %d items", len(geo.peanoCache.items))
+	}
+
+	if _, err := NewGeoData(WithPeanoCache(0)); err == nil {
+		t.Errorf("No error creating a peano cache of size 0")
+	}
+}
+
+// BenchmarkPeanoCache compares calculating the peano codes of a
+// repeated set of city centre search locations with and without the cache
+func BenchmarkPeanoCache(b *testing.B) {
+	cities := [][2]float64{{51.507222, -0.1275}, {48.856667, 2.352222}, {40.712778, -74.006111}, {35.689722, 139.692222}, {-33.868056, 151.209444}}
+	uncached := new(GeoData)
+	cached, _ := NewGeoData(WithPeanoCache(len(cities)))
+	for name, geo := range map[string]*GeoData{"uncached": uncached, "cached": cached} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				city := cities[i%len(cities)]
+				geo.searchPeanos(city[0], city[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// CountNear should count as many records as a Find
+// for CountNearMax results within the same radius,
+// or more where the Find was cut short
+func TestCountNear(t *testing.T) {
+	lines := [][]string{}
+	for i := range 50 {
+		for j := range 50 {
+			id := i*50 + j
+			lines = append(lines, []string{fmt.Sprintf("%d", id), "", "", "", fmt.Sprintf("%d", 1+id%3), fmt.Sprintf("%0.2f", 50+float64(i)/100), fmt.Sprintf("%0.2f", float64(j)/100)})
+		}
+	}
+	geo := populateLines(lines)
+
+	for _, radius := range []float64{0.5, 2, 5, 20} {
+		for _, bitmask := range []uint64{0, 1, 2} {
+			count, err := geo.CountNear(50.25, 0.25, bitmask, radius, "km")
+			if err != nil {
+				t.Fatalf("CountNear failed - %s", err)
+			}
+			res, _ := geo.FindE(50.25, 0.25, bitmask, CountNearMax, "km", "test", WithRadius(radius))
+			// the Find stops at CountNearMax results, but the count needn't
+			if count != len(res) && (len(res) < CountNearMax || count < CountNearMax) {
+				t.Errorf("Counted %d records within %0.1fkm matching %d, but found %d", count, radius, bitmask, len(res))
+			}
+		}
+	}
+	// the filters apply as they do to Find
+	all, _ := geo.CountNear(50.25, 0.25, 0, 2, "km")
+	excluded, _ := geo.CountNear(50.25, 0.25, 0, 2, "km", WithExcludeMask(1))
+	if all == 0 || excluded == 0 || excluded >= all {
+		t.Errorf("Counted %d records excluding flag 1, out of %d", excluded, all)
+	}
+	// about 1.24 miles
+	if miles, _ := geo.CountNear(50.25, 0.25, 0, 1.24, "mi"); miles != all {
+		t.Errorf("Counted %d records within 1.24mi, but %d within 2km", miles, all)
+	}
+
+	if _, err := geo.CountNear(91, 0, 0, 2, "km"); !errors.Is(err, ErrInvalidCoordinates) {
+		t.Errorf("Expected ErrInvalidCoordinates, got %v", err)
+	}
+	if _, err := geo.CountNear(50, 0, 0, 0, "km"); err == nil {
+		t.Errorf("Expected an error for a zero radius")
+	}
+	if _, err := new(GeoData).CountNear(50, 0, 0, 2, "km"); !errors.Is(err, ErrNoData) {
+		t.Errorf("Expected ErrNoData without records, got %v", err)
+	}
+}
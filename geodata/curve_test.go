@@ -0,0 +1,53 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// CurveOrder should list each curve's peano codes in sorted order,
+// each near its records, with every record on each curve once
+func TestCurveOrder(t *testing.T) {
+	geo := PopulateData(51.5, -0.1, 0.01, 200)
+	for _, curve := range []int{1, 2} {
+		points, err := geo.CurveOrder(curve)
+		if err != nil {
+			t.Fatalf("CurveOrder(%d) failed - %s", curve, err)
+		}
+		ids := 0
+		for i, point := range points {
+			if i > 0 && point.Peano <= points[i-1].Peano {
+				t.Errorf("Curve %d peano %d follows %d", curve, point.Peano, points[i-1].Peano)
+			}
+			for _, id := range point.IDs {
+				rec, _ := geo.Record(id)
+				// within a cell of about 0.0055 degrees
+				if math.Abs(rec.Lat-point.Lat) > 0.006 || math.Abs(rec.Lon-point.Lon) > 0.006 {
+					t.Errorf("Record %s at %0.4f, %0.4f is outside its cell at %0.4f, %0.4f on curve %d", id, rec.Lat, rec.Lon, point.Lat, point.Lon, curve)
+				}
+			}
+			ids += len(point.IDs)
+		}
+		if ids != 200 {
+			t.Errorf("Curve %d has %d records instead of 200", curve, ids)
+		}
+	}
+
+	if _, err := geo.CurveOrder(3); err == nil {
+		t.Errorf("Expected an error for curve 3")
+	}
+	single, _ := NewGeoData(WithCurves(1))
+	populateSpiral(single, 51.5, -0.1, 0.01, 10)
+	if _, err := single.CurveOrder(2); err == nil {
+		t.Errorf("Expected an error for the secondary curve when it isn't in use")
+	}
+	if _, err := new(GeoData).CurveOrder(1); !errors.Is(err, ErrNoData) {
+		t.Errorf("Expected ErrNoData without records, got %v", err)
+	}
+}
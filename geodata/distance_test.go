@@ -0,0 +1,187 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"math"
+	"testing"
+)
+
+// dms converts degrees, minutes and seconds into decimal degrees
+func dms(deg, min, sec float64) float64 {
+	return math.Copysign(math.Abs(deg)+min/60+sec/3600, deg)
+}
+
+// TestWGS84 checks WGS84 distances against published reference values
+func TestWGS84(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		metres                 float64
+	}{
+		// Vincenty's own example, from Flinders Peak to Buninyong
+		{"Flinders Peak to Buninyong",
+			dms(-37, 57, 3.72030), dms(144, 25, 29.52440),
+			dms(-37, 39, 10.15610), dms(143, 55, 35.38390), 54972.271},
+		// a degree of longitude along the equator, a * pi / 180
+		{"1 degree of the equator", 0, 0, 0, 1, 111319.491},
+		// a quarter of the meridian
+		{"Equator to the north pole", 0, 0, 90, 0, 10001965.729},
+		{"Same place", 51.5, -0.1, 51.5, -0.1, 0},
+	}
+	for _, test := range tests {
+		km := DistanceWGS84.distance(test.lat1, test.lon1, test.lat2, test.lon2, "km")
+		if math.Abs(km*MetresPerKm-test.metres) > 0.001 {
+			t.Errorf("%s: got %0.4fm, expected %0.3fm", test.name, km*MetresPerKm, test.metres)
+		}
+	}
+
+	// nearly antipodal points on the equator don't converge,
+	// so should fall back to the sphere
+	km := DistanceWGS84.distance(0, 0, 0.5, 179.7, "km")
+	if sphere := haversine(0, 0, 0.5, 179.7, "km"); km != sphere {
+		t.Errorf("Got %0.3fkm for nearly antipodal points, expected the haversine %0.3fkm", km, sphere)
+	}
+}
+
+// TestDistanceModes checks the modes agree over short distances,
+// and that the distance option doesn't change the order of results
+func TestDistanceModes(t *testing.T) {
+	for _, mode := range []DistanceMode{DistanceFast, DistanceHaversine, DistanceCosines, DistanceWGS84} {
+		mi := mode.distance(51.5, -0.1, 51.6, -0.2, "mi")
+		if math.Abs(mi-8.18) > 0.05 {
+			t.Errorf("Mode %d gave %0.3fmi, expected around 8.18mi", mode, mi)
+		}
+	}
+
+	geo := PopulateData(51.5, -0.1, 0.01, 100)
+	fast := geo.Find(51.5, -0.1, 0, 20, "km", "test")
+	wgs84 := geo.Find(51.5, -0.1, 0, 20, "km", "test", WithDistanceMode(DistanceWGS84))
+	if len(fast) != len(wgs84) {
+		t.Fatalf("Got %d fast results but %d WGS84 results", len(fast), len(wgs84))
+	}
+	for i := range fast {
+		if fast[i].ID != wgs84[i].ID {
+			t.Errorf("Result %d was %s, but %s with WGS84 distances", i, fast[i].ID, wgs84[i].ID)
+		}
+	}
+
+	for _, name := range append([]string{""}, DistanceModeNames...) {
+		if _, err := ParseDistanceMode(name); err != nil {
+			t.Errorf("Failed to parse distance mode '%s' - %s", name, err)
+		}
+	}
+	if _, err := ParseDistanceMode("flat"); err == nil {
+		t.Errorf("Expected an error parsing an unknown distance mode")
+	}
+}
+
+// TestCosines compares the spherical law of cosines with the haversine
+// over short and long baselines, and checks it falls back to the flat
+// distance for very short ones
+func TestCosines(t *testing.T) {
+	for _, baseline := range []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+	}{
+		{"2km", 51.5, -0.1, 51.51, -0.12},
+		{"London to Edinburgh", 51.5, -0.1, 55.95, -3.19},
+		{"London to New York", 51.5, -0.1, 40.71, -74.01},
+		{"London to Sydney", 51.5, -0.1, -33.87, 151.21},
+	} {
+		for _, units := range []Units{Kilometres, Miles} {
+			got := DistanceCosines.distance(baseline.lat1, baseline.lon1, baseline.lat2, baseline.lon2, units)
+			expect := haversine(baseline.lat1, baseline.lon1, baseline.lat2, baseline.lon2, units)
+			// within a metre
+			if math.Abs(got-expect) > 0.001 {
+				t.Errorf("%s was %0.6f%s by cosines, but %0.6f%s by haversine", baseline.name, got, units, expect, units)
+			}
+		}
+	}
+
+	// 10m is well under the cosines minimum
+	got := DistanceCosines.distance(51.5, -0.1, 51.5, -0.10014, "km")
+	if flat := DistanceFast.distance(51.5, -0.1, 51.5, -0.10014, "km"); got != flat {
+		t.Errorf("A very short distance was %0.6fkm by cosines, instead of the flat %0.6fkm", got, flat)
+	}
+	if got < 0.009 || got > 0.011 {
+		t.Errorf("A very short distance was %0.6fkm, expected about 10m", got)
+	}
+}
+
+// TestBearing checks the bearings of records placed due north, east,
+// south and west of a search, including across the antimeridian
+func TestBearing(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		bearing                float64
+	}{
+		{"Due north", 51.5, -0.1, 52.5, -0.1, 0},
+		{"Due east along the equator", 0, 10, 0, 11, 90},
+		{"Due south", 51.5, -0.1, 50.5, -0.1, 180},
+		{"Due west along the equator", 0, 10, 0, 9, 270},
+		{"East across the antimeridian", 0, 179.5, 0, -179.5, 90},
+		{"West across the antimeridian", 0, -179.5, 0, 179.5, 270},
+		// the great circle heads north of east before curving south
+		{"London to Paris", 51.5074, -0.1278, 48.8566, 2.3522, 148.1},
+		{"Same place", 51.5, -0.1, 51.5, -0.1, 0},
+	}
+	for _, test := range tests {
+		if got := Bearing(test.lat1, test.lon1, test.lat2, test.lon2); math.Abs(got-test.bearing) > 0.1 {
+			t.Errorf("%s: got a bearing of %0.4f, expected %0.1f", test.name, got, test.bearing)
+		}
+	}
+
+	geo := populateLines([][]string{
+		{"north", "", "", "", "1", "51.51", "-0.1"},
+		{"east", "", "", "", "1", "51.5", "-0.08"},
+	})
+	for _, rec := range geo.Find(51.5, -0.1, 0, 2, "km", "release", WithBearings()) {
+		expected := map[string]float64{"north": 0, "east": 90}[rec.ID]
+		if rec.Bearing == nil || math.Abs(*rec.Bearing-expected) > 0.1 {
+			t.Errorf("Result %s has a bearing of %v, expected %0.1f", rec.ID, rec.Bearing, expected)
+		}
+	}
+	if res := geo.Find(51.5, -0.1, 0, 2, "km", "release"); res[0].Bearing != nil {
+		t.Errorf("Got a bearing without asking for one")
+	}
+}
+
+// TestParseUnits accepts only kilometres and miles, which searches
+// reject anything else too
+func TestParseUnits(t *testing.T) {
+	for input, expected := range map[string]Units{"": Kilometres, "km": Kilometres, "mi": Miles} {
+		if units, err := ParseUnits(input); err != nil || units != expected {
+			t.Errorf("Parsed '%s' as %s with error %v, expected %s", input, units, err, expected)
+		}
+	}
+	for _, invalid := range []string{"furlongs", "KM", "miles", " km"} {
+		if _, err := ParseUnits(invalid); err == nil || err.Error() != "Units '"+invalid+"' must be either 'km' or 'mi'" {
+			t.Errorf("Expected an error parsing '%s', got %v", invalid, err)
+		}
+	}
+
+	geo := PopulateData(51.5, -0.1, 0.001, 10)
+	if res, err := geo.FindE(51.5, -0.1, 0, 5, "", "release"); err != nil || res[0].Units != Kilometres {
+		t.Errorf("Got %v and error %v searching in the default units", res, err)
+	}
+	if _, err := geo.FindE(51.5, -0.1, 0, 5, "furlongs", "release"); err == nil {
+		t.Errorf("Expected an error searching in furlongs")
+	}
+	if _, err := geo.CountNear(51.5, -0.1, 0, 5, "furlongs"); err == nil {
+		t.Errorf("Expected an error counting in furlongs")
+	}
+	if _, err := NewGeoData(WithUnits("furlongs")); err == nil || err.Error() != "Units 'furlongs' must be either 'km' or 'mi'" {
+		t.Errorf("Expected an error defaulting to furlongs, got %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic searching exactly in furlongs")
+		}
+	}()
+	geo.FindExact(51.5, -0.1, 0, 5, "furlongs")
+}
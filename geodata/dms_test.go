@@ -0,0 +1,77 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestParseDMS parses N/S/E/W DMS strings into signed decimal degrees
+func TestParseDMS(t *testing.T) {
+	valid := []struct {
+		dms         string
+		hemispheres string
+		expect      float64
+	}{
+		{`51°30'26"N`, "NS", 51.507222},
+		{`33°52'04"S`, "NS", -33.867778},
+		{`0°07'39"W`, "EW", -0.1275},
+		{`151°12'36"E`, "EW", 151.21},
+		{`51 30 26 N`, "NS", 51.507222},
+		{`N51 30 26`, "NS", 51.507222},
+		{`0:7.65W`, "EW", -0.1275},
+		{`51°30.5'n`, "NS", 51.508333},
+		{`12°`, "EW", 12},
+		{`-33 52 4`, "NS", -33.867778},
+		{`151°12′36″E`, "EW", 151.21},
+	}
+	for _, test := range valid {
+		got, err := ParseDMS(test.dms, test.hemispheres)
+		if err != nil {
+			t.Errorf("Failed to parse '%s' - %s", test.dms, err)
+		} else if math.Abs(got-test.expect) > 0.000001 {
+			t.Errorf("Parsed '%s' as %f instead of %f", test.dms, got, test.expect)
+		}
+	}
+
+	invalid := map[string]string{
+		"a longitude hemisphere for a latitude": `51°30'26"E`,
+		"too many parts":                        `51 30 26 10 N`,
+		"60 minutes":                            `51°60'N`,
+		"a fractional degree with minutes":      `51.5°30'N`,
+		"a sign and a hemisphere":               `-51°30'N`,
+		"no number":                             `N`,
+		"nonsense":                              `north`,
+	}
+	for name, dms := range invalid {
+		if _, err := ParseDMS(dms, "NS"); err == nil {
+			t.Errorf("No error parsing %s '%s'", name, dms)
+		}
+	}
+}
+
+// TestImportDMS imports DMS coordinates, and decimal by default
+func TestImportDMS(t *testing.T) {
+	geo, err := NewGeoData(WithCoordinateFormats(CoordinateDMS, CoordinateDMS))
+	if err != nil {
+		t.Fatalf("Failed to create a GeoData - %s", err)
+	}
+	csv := "ID,Title,Description,URL,Bitmap,Lat,Lon\n" +
+		"1,,,,1,\"51°30'26\"\"N\",\"0°07'39\"\"W\"\n"
+	if err := geo.ImportReader(strings.NewReader(csv), "test"); err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	if rec := geo.records[0]; math.Abs(rec.Lat-51.507222) > 0.000001 || math.Abs(rec.Lon+0.1275) > 0.000001 {
+		t.Errorf("Imported %f, %f instead of 51.507222, -0.1275", rec.Lat, rec.Lon)
+	}
+
+	geo = new(GeoData)
+	if err := geo.ImportReader(strings.NewReader(csv), "test"); err == nil {
+		t.Errorf("No error importing DMS as decimal degrees")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"errors"
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestImportErrors tells apart each kind of import failure,
+// with the line and field where it happened
+func TestImportErrors(t *testing.T) {
+	header := "ID,Title,Description,URL,Bitmap,Lat,Lon,Score\n"
+	for name, test := range map[string]struct {
+		csv   string
+		kind  error
+		line  int
+		field string
+	}{
+		"missing header":   {"ID,Title,Description,URL,Bitmap,Lat\n", ErrImportHeader, 1, "Lon"},
+		"unparsable lat":   {header + "1,,,,1,51.5,-0.1\n2,,,,1,north,-0.1\n", ErrImportCoordinate, 3, "Lat"},
+		"lon out of range": {header + "1,,,,1,51.5,-190\n", ErrImportCoordinate, 2, "Lon"},
+		"NaN lat":          {header + "1,,,,1,NaN,-0.1\n", ErrImportCoordinate, 2, "Lat"},
+		"bad bitmap":       {header + "1,,,,0xg,51.5,-0.1\n", ErrImportField, 2, "Bitmap"},
+		"bad score":        {header + "1,,,,1,51.5,-0.1,high\n", ErrImportField, 2, "Score"},
+		"short line":       {header + "1,,,,1,51.5\n", ErrImportField, 2, ""},
+		"malformed CSV":    {header + "1,,,,1,51.5,-0.1\n2,\"open,,,1,51.5,-0.1\n", ErrImportRead, 3, ""},
+	} {
+		err := new(GeoData).ImportReader(strings.NewReader(test.csv), "test")
+		var importErr *ImportError
+		if !errors.As(err, &importErr) {
+			t.Errorf("Expected an ImportError for the %s, got %v", name, err)
+			continue
+		}
+		for _, kind := range []error{ErrImportHeader, ErrImportCoordinate, ErrImportField, ErrImportRead} {
+			if errors.Is(err, kind) != (kind == test.kind) {
+				t.Errorf("Expected the %s error '%s' to only be %v, but errors.Is %v was %v", name, err, test.kind, kind, kind != test.kind)
+			}
+		}
+		if importErr.Line != test.line || importErr.Field != test.field {
+			t.Errorf("Expected the %s on line %d in field '%s', got line %d field '%s'", name, test.line, test.field, importErr.Line, importErr.Field)
+		}
+	}
+
+	// the underlying error is still available
+	err := new(GeoData).ImportReader(strings.NewReader(header+"1,,,,1,51.5,-0.1,high\n"), "test")
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Errorf("Expected the score's parse error to wrap strconv.ErrSyntax, got %v", err)
+	}
+	err = new(GeoData).Import("/nonexistent.csv", "test")
+	if !errors.Is(err, ErrImportRead) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a read error for a missing file, got %v", err)
+	}
+
+	// as does a repeated ID when syncing
+	geo := PopulateData(51.5, -0.1, 0.001, 10)
+	_, err = geo.SyncReader(strings.NewReader(header+"1,,,,1,51.5,-0.1\n1,,,,1,51.5,-0.1\n"), "test")
+	var importErr *ImportError
+	if !errors.As(err, &importErr) || !errors.Is(err, ErrImportField) || importErr.Field != "ID" || importErr.Line != 3 {
+		t.Errorf("Expected a field error for a repeated ID, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// Importing an exported dump should give the same records
+func TestExportRoundTrip(t *testing.T) {
+	geo := populateLines([][]string{
+		{"1", "Plain", "Nothing special", "https://example.com/1", "0", "51.5", "-0.1"},
+		{"2", "Commas, and \"quotes\"", "Over\ntwo lines", "", "0x8000000000000001", "-33.856784", "151.215297"},
+		{"", "No ID", "", "", "3", "0.1234567890123", "-179.9999999"},
+	})
+	geo.records[0].Score = 4.5
+	geo.records[1].Meta = map[string]string{"phone": "+61 2 9250 7111", "hours": "9-5"}
+	geo.records[2].Meta = map[string]string{"hours": "24/7"}
+
+	var buf bytes.Buffer
+	if err := geo.ExportCSV(&buf); err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+
+	reimported := new(GeoData)
+	if err := reimported.ImportReader(&buf, "release"); err != nil {
+		t.Fatalf("Re-import failed: %s", err)
+	}
+
+	same := func(a, b Record) bool {
+		return sameRecord(&a, &b)
+	}
+	if !slices.EqualFunc(geo.records, reimported.records, same) {
+		t.Errorf("Re-imported records differ\nexported: %v\nre-imported: %v", geo.records, reimported.records)
+	}
+}
+
+// Results should write as CSV like an export, plus their distances
+func TestResultsWriteCSV(t *testing.T) {
+	res := Results{
+		{ID: "near", Title: "Near, \"quoted\"", Bitmap: 1, Lat: 51.5, Lon: -0.1, Units: "km"},
+		{ID: "far", Title: "Far", URL: "https://example.com/far", Bitmap: 2, Lat: 51.51, Lon: -0.1,
+			Distance: 1.112, Units: "km", Meta: map[string]string{"hours": "9-5"}},
+	}
+	var buf bytes.Buffer
+	if err := res.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV failed: %s", err)
+	}
+	expected := "ID,Title,Description,URL,Bitmap,Lat,Lon,Score,Distance,Units,hours\n" +
+		"near,\"Near, \"\"quoted\"\"\",,,1,51.5,-0.1,0,0,km,\n" +
+		"far,Far,,https://example.com/far,2,51.51,-0.1,0,1.112,km,9-5\n"
+	if buf.String() != expected {
+		t.Errorf("Got CSV\n%s\ninstead of\n%s", buf.String(), expected)
+	}
+
+	buf.Reset()
+	if err := Results(nil).WriteCSV(&buf); err != nil || buf.String() != "ID,Title,Description,URL,Bitmap,Lat,Lon,Score,Distance,Units\n" {
+		t.Errorf("Got CSV %q for no results", buf.String())
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"testing"
+)
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		expr   string
+		bitmap uint64
+		expect bool
+	}{
+		{"1", 1, true},
+		{"1", 2, false},
+		{"0x3", 2, true},
+		{"!1", 2, true},
+		{"!!1", 1, true},
+		{"2 & 4", 6, true},
+		{"2 & 4", 2, false},
+		{"2 | 4", 4, true},
+		{"(2 & 4) | !8", 6, true},
+		{"(2 & 4) | !8", 8, false},
+		{"(2 & 4) | !8", 0, true},
+		// AND binds tighter than OR
+		{"1 | 2 & 4", 1, true},
+		{"(1 | 2) & 4", 1, false},
+		// NOT binds tighter than AND
+		{"!1 & 2", 2, true},
+		{"!(1 & 2)", 3, false},
+		{"!(1 & 2)", 1, true},
+	}
+	for _, test := range tests {
+		pred, err := ParseExpression(test.expr)
+		if err != nil {
+			t.Errorf("Failed to parse '%s' - %s", test.expr, err)
+			continue
+		}
+		if got := pred(test.bitmap); got != test.expect {
+			t.Errorf("'%s' on bitmap %d was %v, expected %v", test.expr, test.bitmap, got, test.expect)
+		}
+	}
+
+	for _, expr := range []string{"", "1 &", "(1 | 2", "1 2", "wifi", "1 ^ 2", ")", "0x10000000000000000"} {
+		if _, err := ParseExpression(expr); err == nil {
+			t.Errorf("Expected an error parsing the malformed expression '%s'", expr)
+		}
+	}
+}
+
+// An expression should be used instead of the bitmask
+func TestExpressionFilter(t *testing.T) {
+	geo := populateLines([][]string{
+		{"wifi", "", "", "", "1", "51.5", "-0.1"},
+		{"wifi parking", "", "", "", "3", "51.5", "-0.11"},
+		{"parking", "", "", "", "2", "51.5", "-0.12"},
+	})
+	pred, _ := ParseExpression("1 & !2")
+	// the bitmask of 2 would match the last two
+	res := geo.Find(51.5, -0.1, 2, 10, "km", "test", WithPredicate(pred))
+	if len(res) != 1 || res[0].ID != "wifi" {
+		t.Errorf("Got results %v for '1 & !2'", res)
+	}
+}
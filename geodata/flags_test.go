@@ -0,0 +1,51 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A query by flag names should equal the equivalent numeric mask query
+func TestFlags(t *testing.T) {
+	geo := populateLines([][]string{
+		{"wifi", "", "", "", "1", "51.5", "-0.1"},
+		{"wifi parking", "", "", "", "9", "51.5", "-0.11"},
+		{"parking", "", "", "", "8", "51.5", "-0.12"},
+		{"wifi parking dogs", "", "", "", "0x19", "51.5", "-0.13"},
+	})
+	err := geo.ImportFlagsReader(strings.NewReader("Name,Bit\nwifi,0\nparking,3\ndogs,4\n"))
+	if err != nil {
+		t.Fatalf("Failed to import flags: %s", err)
+	}
+
+	mask, err := geo.FlagMask("wifi", "parking")
+	if err != nil || mask != 0x9 {
+		t.Fatalf("Got mask %#x, error %v, expected 0x9", mask, err)
+	}
+	named := geo.Find(51.5, -0.1, 0, 10, "km", "test", WithRequireMask(mask))
+	numeric := geo.Find(51.5, -0.1, 0, 10, "km", "test", WithRequireMask(0x9))
+	if !reflect.DeepEqual(named, numeric) {
+		t.Errorf("Named flags found %v, but the numeric mask found %v", named, numeric)
+	}
+	if len(named) != 2 || named[0].ID != "wifi parking" || named[1].ID != "wifi parking dogs" {
+		t.Errorf("Got results %v requiring wifi and parking", named)
+	}
+
+	if _, err := geo.FlagMask("wifi", "pool"); err == nil {
+		t.Errorf("Expected an error for an unknown flag")
+	}
+	for _, bad := range []string{"", "Flag,Bit\nwifi,0\n", "Name,Bit\nwifi,64\n", "Name,Bit\nwifi,zero\n", "Name,Bit\nwifi,0\nwifi,1\n"} {
+		if err := new(GeoData).ImportFlagsReader(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error importing flags %q", bad)
+		}
+	}
+	if _, err := NewGeoData(WithFlags(map[string]int{"a b": 1})); err == nil {
+		t.Errorf("Expected an error naming a flag with a space")
+	}
+}
@@ -16,14 +16,22 @@ package geodata
 import (
 	"bufio"
 	"cmp"
+	"compress/gzip"
+	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"math"
+	"net/http"
 	"os"
 	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Geospatial index consisting of the location along a fractal, space-filling curve.
@@ -35,9 +43,10 @@ type Peano uint32
 // We started with 16 bits, but that provides a resolution of
 // about 600m, (diameter of world ~40,000km / 2**16) which might not suit all applications.
 // 19 bits would be under 100m.
-// IF CHANGING THIS - you must also manually change PeanoIndex (index.go) to use a size of 2**PeanoBits
+// This is the default, and also the maximum, because two interleaved 16 bit
+// coordinates fill a 32 bit Peano.  A GeoData can use fewer bits (see WithPeanoBits).
+// IF RAISING THIS - you must also manually change Peano to a uint64
 // and use uint32 instead of uint16 when casting ints in digitiseDegrees...
-// SEE ALSO CalcPeano() which has this hardcoded currently...
 const PeanoBits = 16
 
 // Record holds the raw geographic data. It includes:
@@ -69,8 +78,14 @@ type Record struct {
 	Bitmap      uint64  `json:"bitmap"`
 	Lat         float64 `json:"lat"`
 	Lon         float64 `json:"lon"`
+	Score       float64 `json:"score"`
 	Peano1      Peano   `json:"peano1"`
 	Peano2      Peano   `json:"peano2"`
+	// any extra columns e.g. phone or opening hours, by name
+	Meta map[string]string `json:"meta,omitempty"`
+	// every word of a bitmap wider than 64 bits, the first of
+	// which is also the Bitmap (see Flags)
+	Bitmaps Flags `json:"bitmaps,omitempty"`
 }
 
 // ResultRecord is a record presented to the API output which has a few subtle
@@ -88,8 +103,20 @@ type ResultRecord struct {
 	Bitmap      uint64  `json:"bitmap"`
 	Lat         float64 `json:"lat" binding:"required,float64"`
 	Lon         float64 `json:"lon" binding:"required,float64"`
+	Score       float64 `json:"score"`
 	Distance    float64 `json:"distance" binding:"required,float64"`
-	Units       string  `json:"units" binding:"required,string"`
+	Units       Units   `json:"units" binding:"required,string"`
+	// how many records the result represents, when merging (see WithMerge)
+	Count int `json:"count,omitempty"`
+	// any extra columns of the record, by name
+	Meta map[string]string `json:"meta,omitempty"`
+	// the record's peano codes, for debugging (see WithPeanos)
+	Peano1 *Peano `json:"peano1,omitempty"`
+	Peano2 *Peano `json:"peano2,omitempty"`
+	// the compass bearing from the search location (see WithBearings)
+	Bearing *float64 `json:"bearing,omitempty"`
+	// every word of a bitmap wider than 64 bits
+	Bitmaps Flags `json:"bitmaps,omitempty"`
 }
 
 // Our geospatial data includes the following data structures:
@@ -138,12 +165,64 @@ type ResultRecord struct {
 // instead use an alternative index based on the direct
 // properties instead of geospatial location, and then
 // sort these by location to find the nearest.
+//
+// The remaining fields hold the configuration set by the
+// options passed to NewGeoData, where zero values mean
+// the defaults should be used.
 type GeoData struct {
 	records     []Record
 	peanoIndex1 *PeanoIndex
 	peanoIndex2 *PeanoIndex
 	peanoMap1   map[Peano][]*Record
 	peanoMap2   map[Peano][]*Record
+	// the records by their ID
+	ids map[string]*Record
+
+	peanoBits int
+	offsetLat float64
+	offsetLon float64
+	offsetSet bool
+	curves    int
+	units     Units
+	logLevel  LogLevel
+
+	clusterFraction float64
+	width           int
+	rangeBits       int
+	maxCandidates   int
+	// decimal places of the result distances, if set
+	distanceDecimals    int
+	distanceDecimalsSet bool
+	// decimal places the coordinates are snapped to, if set
+	snapDecimals int
+	snapSet      bool
+	// names of the bit positions of the bitmaps
+	flags map[string]int
+	// formats of the imported lat and lon columns
+	latFormat CoordinateFormat
+	lonFormat CoordinateFormat
+	// how the IDs of records without one are generated
+	idStrategy IDStrategy
+	// the headers of any differently named columns
+	columnNames map[string]string
+	// base of the imported bitmaps, or 0 for any prefixed base
+	bitmapBase int
+	// whether the records are stored in primary peano order
+	peanoLayout bool
+	// directory of the indexes saved by Import, if set
+	indexCache string
+	// how long ImportURL may take, or 0 for DefaultImportTimeout
+	importTimeout time.Duration
+	// the latitudes of the records and searches, if limited
+	minLat  float64
+	maxLat  float64
+	bandSet bool
+	// called every progressEvery rows imported, if set
+	progress      func(rows int)
+	progressEvery int
+
+	peanoCache *peanoCache
+	statsCache statsCache
 }
 
 // Search results slice
@@ -158,6 +237,20 @@ type HeaderPosition struct {
 	Bitmap      int
 	Lat         int
 	Lon         int
+	// the Score column is optional
+	Score    int
+	HasScore bool
+	// any other columns, by name, become the Meta of each record
+	Meta map[string]int
+}
+
+// The columns which the header line must include
+var RequiredHeaders = []string{"ID", "Title", "Description", "URL", "Bitmap", "Lat", "Lon"}
+
+// minColumns returns how many columns a data line needs
+// to include all the required fields
+func (hp *HeaderPosition) minColumns() int {
+	return max(hp.ID, hp.Title, hp.Description, hp.URL, hp.Bitmap, hp.Lat, hp.Lon) + 1
 }
 
 // Origin of secondary offset peano codes,
@@ -180,20 +273,118 @@ const BitmapSize = 64
 // lat/lon fields are float64
 const LatLonSize = 64
 
+// score fields are float64
+const ScoreSize = 64
+
 const KmPerDegree = 111.195
 const MilesPerDegree = 69.094
 
+// Errors returned by FindE, which library users can check with errors.Is
+var (
+	// ErrNoData means there are no records to search
+	ErrNoData = errors.New("No data has been loaded")
+	// ErrInvalidCoordinates means the search lat or lon was outside
+	// their ranges, or wasn't a finite number
+	ErrInvalidCoordinates = errors.New("Invalid coordinates")
+	// ErrPartialResults means the walk along the curves gave up before
+	// finding the maximum number of results, so although the results
+	// returned are valid, there may be other matching records nearby.
+	ErrPartialResults = errors.New("Search attempts exhausted, results may be partial")
+	// ErrUnknownID means no record has the ID searched near
+	ErrUnknownID = errors.New("Unknown record ID")
+)
+
+// validCoordinates checks the lat and lon are within their ranges,
+// which also rules out NaN, as every comparison with NaN is false
+func validCoordinates(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// checkCoordinates returns ErrInvalidCoordinates if a search location
+// is out of range, or outside the latitude band (see WithLatitudeBand)
+func (geo *GeoData) checkCoordinates(lat, lon float64) error {
+	if !validCoordinates(lat, lon) {
+		return fmt.Errorf("%w: lat %0.6f, lon %0.6f", ErrInvalidCoordinates, lat, lon)
+	}
+	if geo.bandSet && (lat < geo.minLat || lat > geo.maxLat) {
+		return fmt.Errorf("%w: lat %0.6f is outside the latitude band %v to %v", ErrInvalidCoordinates, lat, geo.minLat, geo.maxLat)
+	}
+	return nil
+}
+
 // Import a CSV file at the input path
-// and generate our proximity data in-memory
+// and generate our proximity data in-memory,
+// or load its saved index (see WithIndexCache)
 func (geo *GeoData) Import(path string, mode string) error {
+	if geo.indexCache != "" && len(geo.records) == 0 {
+		return geo.importCached(path, mode)
+	}
 	fh, errOpen := os.Open(path)
 	if errOpen != nil {
-		return fmt.Errorf("Failed to open CSV file '%s' - %s", path, errOpen.Error())
+		return importError(ErrImportRead, 0, "", "Failed to open CSV file '%s' - %w", path, errOpen)
 	}
 	defer fh.Close()
 
-	buffer := bufio.NewReader(fh)
+	return geo.ImportReader(fh, mode)
+}
+
+// ImportURL imports CSV data from a URL, e.g. a dataset in object
+// storage, streaming it into ImportReader.  Gzip content encoding is
+// decompressed, and any response but a 200 OK is an error, as is taking
+// longer than the import timeout (see WithImportTimeout), so a stalled
+// server can't hang the import forever.
+func (geo *GeoData) ImportURL(url string, mode string) error {
+	client := http.Client{Timeout: geo.importTimeout}
+	if client.Timeout == 0 {
+		client.Timeout = DefaultImportTimeout
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return importError(ErrImportRead, 0, "", "Failed to fetch CSV from '%s' - %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return importError(ErrImportRead, 0, "", "Failed to fetch CSV from '%s' - %s", url, resp.Status)
+	}
+
+	var body io.Reader = resp.Body
+	// the transport only decompresses gzip it asked for itself
+	if !resp.Uncompressed && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		unzipped, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return importError(ErrImportRead, 0, "", "Failed to decompress CSV from '%s' - %w", url, err)
+		}
+		defer unzipped.Close()
+		body = unzipped
+	}
+	return geo.ImportReader(body, mode)
+}
+
+// ImportReader imports CSV data from any reader, e.g. an HTTP body
+// or a gzip stream, and generates our proximity data in-memory
+func (geo *GeoData) ImportReader(r io.Reader, mode string) error {
+	err := geo.readCSV(r, func(rec *Record, cnt int) error {
+		geo.records = append(geo.records, *rec)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	geo.PopulateIndexes(mode)
+
+	return nil
+}
+
+// readCSV parses each data line of the CSV into a record, and passes
+// it to add along with its line number, reporting progress as it goes
+func (geo *GeoData) readCSV(r io.Reader, add func(rec *Record, cnt int) error) error {
+	buffer := bufio.NewReader(r)
 	reader := csv.NewReader(buffer)
+	// let ImportLine check the number of columns, so a short row
+	// gets a descriptive error, and a trailing optional column
+	// like Score can be left out of a row
+	reader.FieldsPerRecord = -1
 	cnt := 1
 	var headerPos HeaderPosition
 	for {
@@ -203,65 +394,177 @@ func (geo *GeoData) Import(path string, mode string) error {
 			break
 		}
 		if err != nil {
-			return err
+			return readError(err, cnt)
 		}
 
-		err = geo.ImportLine(&headerPos, line, cnt)
+		rec, err := geo.parseLine(&headerPos, line, cnt)
 		if err != nil {
 			return err
 		}
+		if rec != nil {
+			if err := add(rec, cnt); err != nil {
+				return err
+			}
+		}
+		// the first line is the header
+		if geo.progress != nil && cnt > 1 && (cnt-1)%geo.progressEvery == 0 {
+			geo.progress(cnt - 1)
+		}
 
 		cnt++
 	}
-
-	geo.PopulateIndexes(mode)
-
 	return nil
 }
 
 // PopulateIndexes: Populate the Peano binary search indexes & maps
 func (geo *GeoData) PopulateIndexes(mode string) {
+	secondCurve := geo.curveCount() > 1
 	geo.peanoIndex1 = NewPeanoIndex()
 	geo.peanoIndex2 = NewPeanoIndex()
+	geo.peanoIndex1.RangeBits = geo.rangeBits
+	geo.peanoIndex2.RangeBits = geo.rangeBits
 
-	if mode != "release" {
+	if geo.debug(mode) {
 		log.Printf("Generating binary search index for %d records...\n", len(geo.records))
 	}
 
+	if geo.peanoLayout {
+		slices.SortStableFunc(geo.records, func(a, b Record) int {
+			return cmp.Compare(a.Peano1, b.Peano1)
+		})
+	}
+	geo.mapRecords(true)
+
+	timings := []indexTimings{geo.peanoIndex1.process()}
+	if secondCurve {
+		timings = append(timings, geo.peanoIndex2.process())
+	} else {
+		geo.peanoIndex2.Process()
+	}
+	if geo.debug(mode) {
+		for curve, timings := range timings {
+			log.Printf("Index %d built in %s: sort %s, links %s, ranges %s\n", curve+1,
+				timings.sort+timings.links+timings.ranges, timings.sort, timings.links, timings.ranges)
+		}
+	}
+
+	geo.resetStats()
+	geo.checkClustering()
+
+}
+
+// mapRecords maps the IDs and peano codes to the records, also adding
+// each distinct peano code to the indexes if index is set
+func (geo *GeoData) mapRecords(index bool) {
+	secondCurve := geo.curveCount() > 1
 	geo.peanoMap1 = make(map[Peano][]*Record)
 	geo.peanoMap2 = make(map[Peano][]*Record)
 
-	for _, v := range geo.records {
+	// the first record wins if IDs are repeated
+	geo.ids = make(map[string]*Record, len(geo.records))
+	for i := range geo.records {
+		if _, exists := geo.ids[geo.records[i].ID]; !exists {
+			geo.ids[geo.records[i].ID] = &geo.records[i]
+		}
+	}
+
+	// point into the records, rather than at copies,
+	// so their layout in memory is kept (see WithPeanoLayout)
+	for i := range geo.records {
+		v := &geo.records[i]
 		peano1 := v.Peano1
 		peano2 := v.Peano2
 		_, exists1 := geo.peanoMap1[peano1]
 		_, exists2 := geo.peanoMap2[peano2]
 		if exists1 {
-			geo.peanoMap1[peano1] = append(geo.peanoMap1[peano1], &v)
+			geo.peanoMap1[peano1] = append(geo.peanoMap1[peano1], v)
 		} else {
-			geo.peanoMap1[peano1] = []*Record{&v}
-			geo.peanoIndex1.InsertNoReplace(peano1)
+			geo.peanoMap1[peano1] = []*Record{v}
+			if index {
+				geo.peanoIndex1.InsertNoReplace(peano1)
+			}
+		}
+		if !secondCurve {
+			continue
 		}
 		if exists2 {
-			geo.peanoMap2[peano2] = append(geo.peanoMap2[peano2], &v)
+			geo.peanoMap2[peano2] = append(geo.peanoMap2[peano2], v)
 		} else {
-			geo.peanoMap2[peano2] = []*Record{&v}
-			geo.peanoIndex2.InsertNoReplace(peano2)
+			geo.peanoMap2[peano2] = []*Record{v}
+			if index {
+				geo.peanoIndex2.InsertNoReplace(peano2)
+			}
 		}
 	}
 
-	geo.peanoIndex1.Process()
-	geo.peanoIndex2.Process()
+	// keep each peano's records in order of their IDs, rather than of
+	// the records, so a walk stopping part way through a peano takes
+	// the same records whatever the layout (see WithPeanoLayout)
+	for _, pMap := range []map[Peano][]*Record{geo.peanoMap1, geo.peanoMap2} {
+		for _, recs := range pMap {
+			slices.SortStableFunc(recs, func(a, b *Record) int {
+				return cmp.Compare(a.ID, b.ID)
+			})
+		}
+	}
+}
 
+// RecomputePeanos recalculates both peano codes of every record from its
+// coordinates, and rebuilds the indexes, e.g. after SetOffset.  Like
+// Import, it mustn't run at the same time as any searches.
+func (geo *GeoData) RecomputePeanos(mode string) {
+	for i := range geo.records {
+		rec := &geo.records[i]
+		lat, lon := geo.snap(rec.Lat, rec.Lon)
+		rec.Peano1 = geo.calcPeano(lat, lon)
+		rec.Peano2 = geo.calcPeanoOffset(lat, lon)
+	}
+	geo.peanoCache.clear()
+	geo.PopulateIndexes(mode)
+}
+
+// SetOffset changes the origin of the secondary curve, like WithOffset,
+// and recomputes the peano codes (see RecomputePeanos)
+func (geo *GeoData) SetOffset(lat, lon float64, mode string) error {
+	offLat, offLon, offSet := geo.offsetLat, geo.offsetLon, geo.offsetSet
+	err := WithOffset(lat, lon)(geo)
+	if err == nil {
+		err = geo.validate()
+	}
+	if err != nil {
+		geo.offsetLat, geo.offsetLon, geo.offsetSet = offLat, offLon, offSet
+		return err
+	}
+	geo.RecomputePeanos(mode)
+	return nil
 }
 
 // ImportLine imports a line of data into our in-memory search system
-func (geo *GeoData) ImportLine(hp *HeaderPosition, line []string, cnt int) (err error) {
+func (geo *GeoData) ImportLine(hp *HeaderPosition, line []string, cnt int) error {
+	rec, err := geo.parseLine(hp, line, cnt)
+	if err != nil || rec == nil {
+		return err
+	}
+	geo.records = append(geo.records, *rec)
+	return nil
+}
+
+// parseLine parses a data line of the CSV into a record, or stores the
+// header positions from the header line, returning a nil record
+func (geo *GeoData) parseLine(hp *HeaderPosition, line []string, cnt int) (rec *Record, err error) {
 
 	// handle the header line by storing the header positions
 	if cnt == 1 {
+		line = geo.renameColumns(line)
 		storeHeaders(hp, line)
-		return nil
+		// a missing header would leave its position at 0,
+		// silently reading that field from the first column
+		for _, header := range RequiredHeaders {
+			if !slices.Contains(line, header) {
+				return nil, importError(ErrImportHeader, cnt, header, "The header line is missing the '%s' column", header)
+			}
+		}
+		return nil, nil
 	}
 
 	// import a data line
@@ -269,25 +572,38 @@ func (geo *GeoData) ImportLine(hp *HeaderPosition, line []string, cnt int) (err
 	if hp == nil {
 		panic("No headers line found in this CSV file!")
 	}
+	if len(line) < hp.minColumns() {
+		return nil, importError(ErrImportField, cnt, "", "Line %d has %d columns, expected at least %d", cnt, len(line), hp.minColumns())
+	}
 
-	bmap, errBmap := strconv.ParseUint(line[hp.Bitmap], 0, BitmapSize)
+	bmap, bitmaps, errBmap := geo.parseBitmaps(line[hp.Bitmap])
 	if errBmap != nil {
-		return fmt.Errorf("On line %d failed to parse bitmap '%s' - %s", cnt, line[hp.Bitmap], errBmap)
+		return nil, importError(ErrImportField, cnt, "Bitmap", "On line %d failed to parse bitmap '%s' - %w", cnt, line[hp.Bitmap], errBmap)
 	}
-	lat, errLat := strconv.ParseFloat(line[hp.Lat], LatLonSize)
+	lat, errLat := parseCoordinate(line[hp.Lat], geo.latFormat, "NS")
 	if errLat != nil {
-		return fmt.Errorf("On line %d failed to parse lat '%s' - %s", cnt, line[hp.Lat], errBmap)
+		return nil, importError(ErrImportCoordinate, cnt, "Lat", "On line %d failed to parse lat '%s' - %w", cnt, line[hp.Lat], errLat)
+	}
+	// ParseFloat accepts "NaN" and "Inf", which would corrupt the peano codes
+	if math.IsNaN(lat) || math.IsInf(lat, 0) {
+		return nil, importError(ErrImportCoordinate, cnt, "Lat", "On line %d lat '%s' is not a finite number", cnt, line[hp.Lat])
 	}
 	if lat > 90 || lat < -90 {
-		return fmt.Errorf("On line %d lat '%s' outside range -90 to +90", cnt, line[hp.Lat])
+		return nil, importError(ErrImportCoordinate, cnt, "Lat", "On line %d lat '%s' outside range -90 to +90", cnt, line[hp.Lat])
+	}
+	if geo.bandSet && (lat < geo.minLat || lat > geo.maxLat) {
+		return nil, importError(ErrImportCoordinate, cnt, "Lat", "On line %d lat '%s' is outside the latitude band %v to %v", cnt, line[hp.Lat], geo.minLat, geo.maxLat)
 	}
 
-	lon, errLon := strconv.ParseFloat(line[hp.Lon], LatLonSize)
+	lon, errLon := parseCoordinate(line[hp.Lon], geo.lonFormat, "EW")
 	if errLon != nil {
-		return fmt.Errorf("On line %d failed to parse lon '%s' - %s", cnt, line[hp.Lon], errBmap)
+		return nil, importError(ErrImportCoordinate, cnt, "Lon", "On line %d failed to parse lon '%s' - %w", cnt, line[hp.Lon], errLon)
+	}
+	if math.IsNaN(lon) || math.IsInf(lon, 0) {
+		return nil, importError(ErrImportCoordinate, cnt, "Lon", "On line %d lon '%s' is not a finite number", cnt, line[hp.Lon])
 	}
 	if lon > 180 || lon < -180 {
-		return fmt.Errorf("On line %d lat '%s' outside range -180 to +180", cnt, line[hp.Lat])
+		return nil, importError(ErrImportCoordinate, cnt, "Lon", "On line %d lon '%s' outside range -180 to +180", cnt, line[hp.Lon])
 	}
 
 	newR := Record{
@@ -295,124 +611,102 @@ func (geo *GeoData) ImportLine(hp *HeaderPosition, line []string, cnt int) (err
 		Description: line[hp.Description],
 		URL:         line[hp.URL],
 		Bitmap:      bmap,
+		Bitmaps:     bitmaps,
 		Lat:         lat,
 		Lon:         lon,
 	}
+	if hp.HasScore && hp.Score < len(line) && line[hp.Score] != "" {
+		newR.Score, err = strconv.ParseFloat(line[hp.Score], ScoreSize)
+		if err != nil {
+			return nil, importError(ErrImportField, cnt, "Score", "On line %d failed to parse score '%s' - %w", cnt, line[hp.Score], err)
+		}
+	}
+	// extra columns are optional, like the Score
+	for name, i := range hp.Meta {
+		if i < len(line) && line[i] != "" {
+			if newR.Meta == nil {
+				newR.Meta = make(map[string]string)
+			}
+			newR.Meta[name] = line[i]
+		}
+	}
 	if line[hp.ID] != "" {
 		newR.ID = line[hp.ID]
 	} else {
-		newR.ID = fmt.Sprintf("%d", cnt)
+		newR.ID = geo.generateID(&newR, cnt)
 	}
 
-	newR.Peano1 = CalcPeano(lat, lon)
-	newR.Peano2 = CalcPeanoOffset(lat, lon)
+	// the peano codes may be of snapped coordinates, but not the record's
+	snappedLat, snappedLon := geo.snap(lat, lon)
+	newR.Peano1 = geo.calcPeano(snappedLat, snappedLon)
+	newR.Peano2 = geo.calcPeanoOffset(snappedLat, snappedLon)
 
-	geo.records = append(geo.records, newR)
-
-	return nil
+	return &newR, nil
 }
 
 // Search the geodata for matching records
-func (geo *GeoData) Find(lat, lon float64, bitmask uint64, max uint64, units string, mode string) []ResultRecord {
-
-	// final results to return
-	var res []ResultRecord
-	// intermediate slice of records to sort & potentially limit before becoming results
-	var recs []Record
+func (geo *GeoData) Find(lat, lon float64, bitmask uint64, max uint64, units Units, mode string, opts ...FindOption) []ResultRecord {
+	res, _ := geo.FindE(lat, lon, bitmask, max, units, mode, opts...)
+	return res
+}
 
-	uniqueRecords := make(map[string]bool)
+// FindE searches the geodata for matching records like Find, but also
+// returns ErrNoData, ErrInvalidCoordinates, or ErrPartialResults, or an
+// error for units other than Kilometres, Miles or empty (see ParseUnits).
+// Note that ErrPartialResults is returned along with the results found.
+func (geo *GeoData) FindE(lat, lon float64, bitmask uint64, max uint64, units Units, mode string, opts ...FindOption) (Results, error) {
+	return geo.FindCtx(context.Background(), lat, lon, bitmask, max, units, mode, opts...)
+}
 
-	// Don't go past the number of results desired when
-	// walking along either peano curve in either direction
-	var maxResUp1, maxResUp2, maxResDown1, maxResDown2 int
-	intMax := int(max)
-	maxResUp1 = intMax
-	maxResUp2 = intMax
-	maxResDown1 = intMax
-	maxResDown2 = intMax
+// FindCtx searches the geodata for matching records like FindE, but
+// gives up walking the curves as soon as the context is cancelled,
+// e.g. when an HTTP client disconnects, returning the context's error
+// along with any results found by then.
+func (geo *GeoData) FindCtx(ctx context.Context, lat, lon float64, bitmask uint64, max uint64, units Units, mode string, opts ...FindOption) (Results, error) {
+	// final results to return
+	var res Results
+	err := geo.find(ctx, lat, lon, bitmask, max, units, newQuery(opts), func(rec ResultRecord) bool {
+		res = append(res, rec)
+		return true
+	})
+	return res, err
+}
 
-	// Don't keep trying to obtain results indefinitely
-	var maxAt, maxAttemptsUp1, maxAttemptsUp2, maxAttemptsDown1, maxAttemptsDown2 int
-	maxAt = int(max * 4)
-	maxAttemptsUp1 = maxAt
-	maxAttemptsUp2 = maxAt
-	maxAttemptsDown1 = maxAt
-	maxAttemptsDown2 = maxAt
+// FindStream searches the geodata for matching records like FindE, but
+// calls yield with each result in order instead of returning them all,
+// stopping as soon as yield returns false, e.g. to stream many results
+// to a client, or to stop at the first one good enough.  The curves are
+// still walked and the candidates sorted before the first result, but
+// each result is only built when it's yielded, unless WithMerge,
+// WithRelativeCutoff, WithShuffle or WithDistanceHistogram need them all
+// first.  Stopping early isn't counted as ErrPartialResults.
+func (geo *GeoData) FindStream(lat, lon float64, bitmask uint64, max uint64, units Units, mode string, yield func(ResultRecord) bool, opts ...FindOption) error {
+	return geo.find(context.Background(), lat, lon, bitmask, max, units, newQuery(opts), yield)
+}
 
-	if units != "mi" {
-		units = "km"
+// find searches for the records matching the query, calling yield with
+// each result in order until it returns false, see FindCtx and FindStream
+func (geo *GeoData) find(ctx context.Context, lat, lon float64, bitmask uint64, max uint64, units Units, q *query, yield func(ResultRecord) bool) error {
+	units, err := geo.searchUnits(units)
+	if err != nil {
+		return err
 	}
 
-	// obtain our Peano & offset Peano codes for our input coords
-	peano1 := CalcPeano(lat, lon)
-	peano2 := CalcPeanoOffset(lat, lon)
-
-	// find the locations of the first record matching
-	// these peanos in the peanoIndex
-	iterator := func(peano Peano, maxAttempts *int, maxRes *int, pMap map[Peano][]*Record) bool {
-
-		// Cut out in case there are no matching results
-		*maxAttempts--
-		if *maxAttempts < 0 {
-			return false
-		}
-		candidates, exists := pMap[peano]
-		if !exists {
-			// e.g. a peano generated by subtracting one from an existing one
-			return true
-		}
-		for _, rec := range candidates {
-			if _, exists := uniqueRecords[rec.ID]; exists {
-				continue
-			}
-			uniqueRecords[rec.ID] = true
-
-			// check each record matches the bitmask, if provided
-			if bitmask > 0 {
-				// Assume A OR B OR C ... for the bitmask
-				// we will add more boolean logic later...
-				if (rec.Bitmap & bitmask) == 0 {
-					// the OR logic FAILED, so return early
-					// but continue iterating (true)
-					return true
-				}
-			}
-			// cut out if we've hit the maximum desired results
-			*maxRes--
-			if *maxRes < 0 {
-				return false
-			}
-			// add the record to our intermediate slice of records
-			recs = append(recs, *rec)
-		}
-		return true
-	}
-
-	// curry some additional data into the iterators
-	iteratorUp1 := func(p Peano, first bool) bool {
-		return iterator(p, &maxAttemptsUp1, &maxResUp1, geo.peanoMap1)
-	}
-	iteratorDown1 := func(p Peano, first bool) bool {
-		return iterator(p, &maxAttemptsDown1, &maxResDown1, geo.peanoMap1)
-	}
-	iteratorUp2 := func(p Peano, first bool) bool {
-		return iterator(p, &maxAttemptsUp2, &maxResUp2, geo.peanoMap2)
+	// nothing to search if no records were imported
+	if geo.peanoIndex1.Len() == 0 {
+		return ErrNoData
 	}
-	iteratorDown2 := func(p Peano, first bool) bool {
-		return iterator(p, &maxAttemptsDown2, &maxResDown2, geo.peanoMap2)
+	if err := geo.checkCoordinates(lat, lon); err != nil {
+		return err
 	}
 
+	// obtain our Peano & offset Peano codes for our input coords
+	peano1, peano2 := geo.searchPeanos(lat, lon)
+
 	// traverse each index up and down and merge the results into recs
-	geo.peanoIndex1.AscendGreaterOrEqual(peano1, iteratorUp1)
-	if peano1 > 0 {
-		// subtract 1 to avoid duplicating that peano
-		geo.peanoIndex1.DescendLessOrEqual(peano1-1, iteratorDown1)
-	}
-	geo.peanoIndex2.AscendGreaterOrEqual(peano2, iteratorUp2)
-	if peano2 > 0 {
-		// subtract 1 to avoid duplicating that peano
-		geo.peanoIndex2.DescendLessOrEqual(peano2-1, iteratorDown2)
-	}
+	walks := geo.searchWalks(ctx, lat, lon, peano1, peano2, q, bitmask, int(max), units)
+	// intermediate slice of records to sort & potentially limit before becoming results
+	recs, exhausted := runWalks(walks, max >= ParallelWalkMin && !q.sequential)
 
 	// Sort by proximity before cutting down to the expected result count.
 	// One option here might be to use a fake proximity e.g. (abs(x) + abs(y))
@@ -425,40 +719,231 @@ func (geo *GeoData) Find(lat, lon float64, bitmask uint64, max uint64, units str
 	// calculations.
 	// Perhaps if a larger number of results were being returned it might
 	// be worthwhile?
-	recProx := make(map[string]float64)
-	for _, rec := range recs {
-		deltaLat := lat - rec.Lat
-		recProx[rec.ID] = proximityForSort(deltaLat/2, deltaLat, lon-rec.Lon)
+	// The candidates point at the records rather than copying them,
+	// because there can be many more candidates than results.
+	candidates := make([]candidate, len(recs))
+	for i, rec := range recs {
+		candidates[i] = candidate{rec: rec, key: q.sortKey(recordProximity(lat, lon, rec), rec)}
 	}
-	sorter := func(a, b Record) int {
-		proxA, _ := recProx[a.ID]
-		proxB, _ := recProx[b.ID]
-		return cmp.Compare(proxA, proxB)
+	slices.SortFunc(candidates, q.compare())
+
+	// merging, the relative cutoff, shuffling and the histogram
+	// need all the results before any of them are yielded
+	var res Results
+	buffered := q.merge > 0 || q.relative > 0 || q.shuffle > 0 || q.histogram != nil
+	found, stopped := 0, false
+
+	// Cut down the results to either the smaller of the desired
+	// max records or the count of the current results, leaving
+	// out any beyond the radius, and merging any close together
+	maxLen := min(uint64(len(candidates)), max)
+	if buffered && maxLen > 0 {
+		res = make(Results, 0, maxLen)
 	}
-	slices.SortFunc(recs, sorter)
-
-	// Cut down the results by slicing by either the smaller of the desired
-	// max records or the count of the current results
-	maxLen := min(uint64(len(recs)), max)
-	for _, rec := range recs[:maxLen] {
-		rrec := ResultRecord{
-			ID:          rec.ID,
-			Title:       rec.Title,
-			Description: rec.Description,
-			URL:         rec.URL,
-			Bitmap:      rec.Bitmap,
-			Lat:         rec.Lat,
-			Lon:         rec.Lon,
-			Distance:    proximity(recProx[rec.ID], units),
-			Units:       units,
+	for _, c := range candidates {
+		if uint64(found) == maxLen {
+			break
+		}
+		distance := q.distanceMode.distance(lat, lon, c.rec.Lat, c.rec.Lon, units)
+		if q.radius > 0 && distance > q.radius {
+			continue
+		}
+		if q.merge > 0 && mergeResult(res, c.rec, q.merge, units) {
+			continue
+		}
+		result := newResultRecord(c.rec, geo.roundDistance(distance), units)
+		if q.merge > 0 {
+			result.Count = 1
+		}
+		if q.peanos != nil {
+			peano1, peano2 := c.rec.Peano1, c.rec.Peano2
+			result.Peano1, result.Peano2 = &peano1, &peano2
+		}
+		if q.bearings {
+			bearing := Bearing(lat, lon, c.rec.Lat, c.rec.Lon)
+			result.Bearing = &bearing
+		}
+		found++
+		if buffered {
+			res = append(res, result)
+		} else if !yield(result) {
+			stopped = true
+			break
+		}
+	}
+	if q.peanos != nil {
+		*q.peanos = PeanoCodes{Peano1: peano1, Peano2: peano2}
+	}
+	if buffered {
+		if q.relative > 0 {
+			res = q.cutRelative(res)
+		}
+		if q.shuffle > 0 {
+			q.shuffleResults(res)
 		}
+		if q.histogram != nil {
+			q.histogram.record(res)
+		}
+		found = len(res)
+		for _, result := range res {
+			if !yield(result) {
+				stopped = true
+				break
+			}
+		}
+	}
+	if q.stats != nil {
+		q.stats.record(walks, found)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if exhausted && !stopped && uint64(found) < max {
+		return ErrPartialResults
+	}
+	return nil
+}
+
+// FindNearID searches for the records nearest to an existing record,
+// e.g. for "other places near this one", like FindE at the record's
+// coordinates but leaving the record itself out of the results.
+// It returns ErrUnknownID if no record has the ID.
+func (geo *GeoData) FindNearID(id string, bitmask uint64, max uint64, units Units, opts ...FindOption) (Results, error) {
+	anchor, found := geo.Record(id)
+	if !found {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownID, id)
+	}
+	// one more, in case the anchor itself is found
+	res, err := geo.FindE(anchor.Lat, anchor.Lon, bitmask, max+1, units, "release", opts...)
+	res = slices.DeleteFunc(res, func(rec ResultRecord) bool {
+		return rec.ID == id
+	})
+	if uint64(len(res)) > max {
+		res = res[:max]
+	}
+	return res, err
+}
+
+// FindWithinRadius searches for the nearest records within the radius,
+// in the units of the search, up to max of them, e.g. "the nearest 10,
+// but only those within 2km" for a store locator.  It returns however
+// many of the max are within the radius, which may be none, so unlike
+// FindE it doesn't count running out of records as ErrPartialResults.
+func (geo *GeoData) FindWithinRadius(lat, lon float64, radius float64, bitmask uint64, max uint64, units Units, opts ...FindOption) (Results, error) {
+	if !(radius > 0) {
+		return nil, fmt.Errorf("Radius %v must be positive", radius)
+	}
+	res, err := geo.FindE(lat, lon, bitmask, max, units, "release", append(opts, WithRadius(radius))...)
+	if errors.Is(err, ErrPartialResults) {
+		err = nil
+	}
+	return res, err
+}
+
+// Record looks up a record by its ID, once the indexes are populated
+func (geo *GeoData) Record(id string) (Record, bool) {
+	rec, found := geo.ids[id]
+	if !found {
+		return Record{}, false
+	}
+	return *rec, true
+}
+
+// Number of matching records gathered from each direction along
+// each curve by Nearest, before picking the nearest of them.
+// One record per direction is usually enough, but the nearest
+// record along a curve isn't always the nearest on the ground.
+const NearestCandidates = 4
+
+// Nearest returns the single closest record matching the bitmask,
+// or false if no record matches.  It cuts the walk along the curves
+// short after NearestCandidates matches in each direction, so it's
+// quicker than asking Find for its usual number of results.
+func (geo *GeoData) Nearest(lat, lon float64, bitmask uint64, units Units) (ResultRecord, bool) {
+	res, _ := geo.FindE(lat, lon, bitmask, NearestCandidates, units, "release")
+	if len(res) == 0 {
+		return ResultRecord{}, false
+	}
+	return res[0], true
+}
 
-		res = append(res, rrec)
+// FindExact is a slow but exact "brute force" search of every record,
+// which acts as an oracle to measure the accuracy of the peano curve
+// walks in Find.  It uses the same filters and proximity estimate
+// as Find, so any differences are down to the curves alone.
+// It panics on invalid units, which can only be a mistake in the
+// test calling it.  Not recommended for use in production!
+func (geo *GeoData) FindExact(lat, lon float64, bitmask uint64, max uint64, units Units, opts ...FindOption) Results {
+	match := newQuery(opts).matcher(bitmask)
+	units, err := geo.searchUnits(units)
+	if err != nil {
+		panic(err)
 	}
 
+	// keep only the nearest max records found so far, in order
+	var nearest []candidate
+	for i := range geo.records {
+		rec := &geo.records[i]
+		if !match(rec) {
+			continue
+		}
+		c := candidate{rec: rec, key: recordProximity(lat, lon, rec)}
+		if uint64(len(nearest)) == max && (max == 0 || c.compare(nearest[max-1]) >= 0) {
+			continue
+		}
+		pos, _ := slices.BinarySearchFunc(nearest, c, candidate.compare)
+		nearest = slices.Insert(nearest, pos, c)
+		if uint64(len(nearest)) > max {
+			nearest = nearest[:max]
+		}
+	}
+
+	var res Results
+	for _, near := range nearest {
+		distance := DistanceFast.distance(lat, lon, near.rec.Lat, near.rec.Lon, units)
+		res = append(res, newResultRecord(near.rec, geo.roundDistance(distance), units))
+	}
 	return res
 }
 
+// candidate is a record found along the curves, with its sort key
+type candidate struct {
+	rec *Record
+	key float64
+}
+
+// compare orders candidates by their sort key, then by their ID, so
+// that equally near records are always in the same order
+func (a candidate) compare(b candidate) int {
+	return cmp.Or(cmp.Compare(a.key, b.key), cmp.Compare(a.rec.ID, b.rec.ID))
+}
+
+// recordProximity estimates the square of the proximity
+// of a record to the search location (see proximityForSort),
+// scaling the longitude by the cosine of their mid latitude
+func recordProximity(lat, lon float64, rec *Record) float64 {
+	return proximityForSort((lat+rec.Lat)/2, lat-rec.Lat, lon-rec.Lon)
+}
+
+// newResultRecord presents a record as a search result
+func newResultRecord(rec *Record, distance float64, units Units) ResultRecord {
+	return ResultRecord{
+		ID:          rec.ID,
+		Title:       rec.Title,
+		Description: rec.Description,
+		URL:         rec.URL,
+		Bitmap:      rec.Bitmap,
+		Lat:         rec.Lat,
+		Lon:         rec.Lon,
+		Score:       rec.Score,
+		Distance:    distance,
+		Units:       units,
+		Meta:        maps.Clone(rec.Meta),
+		Bitmaps:     slices.Clone(rec.Bitmaps),
+	}
+}
+
 // storeHeaders handles the CSV header line, saving header positions
 func storeHeaders(hp *HeaderPosition, line []string) {
 	for i, v := range line {
@@ -477,8 +962,15 @@ func storeHeaders(hp *HeaderPosition, line []string) {
 			hp.Lat = i
 		case "Lon":
 			hp.Lon = i
+		case "Score":
+			hp.Score = i
+			hp.HasScore = true
 		default:
-			panic(fmt.Sprintf("header field '%s' not recognised!", v))
+			// an extra column, e.g. a phone number
+			if hp.Meta == nil {
+				hp.Meta = make(map[string]int)
+			}
+			hp.Meta[v] = i
 		}
 	}
 }
@@ -488,9 +980,29 @@ func storeHeaders(hp *HeaderPosition, line []string) {
 // where 1.0 latitude = 1.0 longitude (although in reality the earth
 // is closer to an ellipsoid).
 func CalcPeano(lat, lon float64) Peano {
+	return calcPeanoBits(lat, lon, PeanoBits)
+}
+
+// calcPeano calculates a peano code at the resolution configured for geo
+func (geo *GeoData) calcPeano(lat, lon float64) Peano {
+	return calcPeanoBits(lat, lon, geo.bits())
+}
+
+// calcPeanoOffset calculates a secondary peano code using
+// the offset and resolution configured for geo
+func (geo *GeoData) calcPeanoOffset(lat, lon float64) Peano {
+	offLat, offLon := geo.offset()
+	latOffset, lonOffset := offsetBy(lat, lon, offLat, offLon)
+	return calcPeanoBits(latOffset, lonOffset, geo.bits())
+}
+
+// calcPeanoBits calculates a peano code keeping only
+// the top 'bits' bits of each digitised coordinate
+func calcPeanoBits(lat, lon float64, bits int) Peano {
 
-	// TODO - use PeanoBits to generalise this func instead of assuming 16bits
 	lat16, lon16 := digitiseDegrees(lat, lon)
+	lat16 >>= PeanoBits - bits
+	lon16 >>= PeanoBits - bits
 
 	var maskIn uint16
 	var maskOut uint32
@@ -505,7 +1017,7 @@ func CalcPeano(lat, lon float64) Peano {
 	maskIn = 1
 	maskOut = 2
 
-	for range 16 {
+	for range bits {
 
 		if (lat16 & maskIn) != 0 {
 			peano += maskOut
@@ -517,7 +1029,7 @@ func CalcPeano(lat, lon float64) Peano {
 
 	maskIn = 1
 	maskOut = 1
-	for range 16 {
+	for range bits {
 
 		if (lon16 & maskIn) != 0 {
 			peano += maskOut
@@ -530,6 +1042,59 @@ func CalcPeano(lat, lon float64) Peano {
 	return Peano(peano)
 }
 
+// DecodePeano is the inverse of CalcPeano, returning the coordinates
+// of the centre of the cell of the input peano code.  CalcPeano quantises
+// each coordinate into one of 65536 steps, so this is at most half a cell
+// (see PeanoCellDegrees) from the coordinates which were encoded, i.e.
+// within about 300m north-south or east-west at the equator.
+func DecodePeano(p Peano) (lat, lon float64) {
+	return decodePeanoBits(p, PeanoBits)
+}
+
+// decodePeanoBits is the inverse of calcPeanoBits
+func decodePeanoBits(p Peano, bits int) (lat, lon float64) {
+	var lat16, lon16 uint16
+	for bit := range bits {
+		if p&(2<<(2*bit)) != 0 {
+			lat16 |= 1 << bit
+		}
+		if p&(1<<(2*bit)) != 0 {
+			lon16 |= 1 << bit
+		}
+	}
+	// the centre of the cell, in the full 16 bit resolution
+	shift := PeanoBits - bits
+	half := float64(uint32(1)<<shift) / 2
+	return undigitiseDegrees(float64(uint32(lat16)<<shift)+half, float64(uint32(lon16)<<shift)+half)
+}
+
+// PeanoCellDegrees returns the size of a cell of a peano code with
+// the input number of bits, in degrees of latitude and longitude
+func PeanoCellDegrees(bits int) (lat, lon float64) {
+	steps := float64(uint32(1) << (PeanoBits - bits))
+	return steps * DegreesPerStep, steps * DegreesPerStep
+}
+
+// CellResolution returns the approximate ground size in metres of a cell
+// of the default peano codes (see PeanoBits) at the input latitude, i.e.
+// the floor of their accuracy.  The cells are square in degrees, so the
+// size is their east-west width, which shrinks with the cosine of the
+// latitude. Their north-south height is the same as at the equator.
+func CellResolution(lat float64) float64 {
+	return cellResolution(lat, PeanoBits)
+}
+
+// CellResolution is like the package CellResolution,
+// at the resolution configured for geo (see WithPeanoBits)
+func (geo *GeoData) CellResolution(lat float64) float64 {
+	return cellResolution(lat, geo.bits())
+}
+
+func cellResolution(lat float64, bits int) float64 {
+	_, cellLon := PeanoCellDegrees(bits)
+	return cellLon * KmPerDegree * MetresPerKm * math.Cos(lat*math.Pi/180)
+}
+
 // CalcPeanoOffset calculates an offset geo coordinate for
 // our secondary peano codes
 func CalcPeanoOffset(lat, lon float64) (peano Peano) {
@@ -537,15 +1102,35 @@ func CalcPeanoOffset(lat, lon float64) (peano Peano) {
 	return CalcPeano(latOffset, lonOffset)
 }
 
+// Both coordinates are digitised into 65536 steps of a 360 degree
+// range, so the peano cells are square (in degrees).  Latitudes only
+// use the middle half of their range, from 16384 at -90 to 49152 at
+// +90, leaving room for the offset latitudes of the secondary curve
+// (see WithOffset) which can go up to 90 degrees beyond the poles.
+const DegreesPerStep = 360.0 / 65536
+
 // digitiseDegrees converts a floating point geospatial
 // coordinate into a lower resolution integer coordinate
 func digitiseDegrees(lat, lon float64) (lat16, lon16 uint16) {
 	// Convert the lat/lon into 16 bit ints
 	// centered on the equator (ie. 32768=Equator)
-	// and the 0 = -180deg, 65536 = +180deg
-	lat16 = uint16(((lat + 90.0) / 180.0 * 32767) + 16384)
-	lon16 = uint16((lon + 180.0) / 360.0 * 65535)
-	return lat16, lon16
+	// and the 0 = -180deg, 65535 = +180deg
+	return digitiseDegree(lat), digitiseDegree(lon)
+}
+
+// digitiseDegree converts a coordinate from -180 to +180 degrees
+// into 16 bits, clamping it so the extremes can't wrap around
+func digitiseDegree(deg float64) uint16 {
+	step := math.Floor((deg + 180.0) / DegreesPerStep)
+	return uint16(max(0, min(math.MaxUint16, step)))
+}
+
+// undigitiseDegrees is the inverse of digitiseDegrees, for
+// fractional integer coordinates, within the valid ranges
+func undigitiseDegrees(lat16, lon16 float64) (lat, lon float64) {
+	lat = lat16*DegreesPerStep - 180.0
+	lon = lon16*DegreesPerStep - 180.0
+	return max(-90, min(90, lat)), max(-180, min(180, lon))
 }
 
 // Offset the input lat/lon degrees by a particular
@@ -554,10 +1139,16 @@ func digitiseDegrees(lat, lon float64) (lat16, lon16 uint16) {
 // one good approximation, removing the chance of being near the
 // edge of a larger quad-tree boundary.
 func Offset(lat, lon float64) (latOff, lonOff float64) {
+	return offsetBy(lat, lon, OffsetLat, OffsetLon)
+}
+
+// offsetBy offsets the input lat/lon degrees by any
+// particular distance in lat and lon
+func offsetBy(lat, lon, offLat, offLon float64) (latOff, lonOff float64) {
 
 	// Offset the coordinates
-	latOff = lat + OffsetLat
-	lonOff = lon + OffsetLon
+	latOff = lat + offLat
+	lonOff = lon + offLon
 
 	// Wrap to the other side of the world horizontally
 	// (not needed vertically because still inside the peano's square
@@ -580,14 +1171,15 @@ func Offset(lat, lon float64) (latOff, lonOff float64) {
 // x = cos(lat) * lon * C (constant based on size of earth)
 // We use only positive latitudes to save space, should we
 // increase the size of this table.
+// It's generated on first use, once, as concurrent searches may
+// all be the first.
 var cosineTable map[int]float64
+var cosineTableOnce sync.Once
 
 // cosineEstimate looks up our cosineTable for a fast
 // estimate of the cos trigonometric function.
 func cosineEstimate(latInt int) float64 {
-	if cosineTable == nil {
-		generateCosineTable()
-	}
+	cosineTableOnce.Do(generateCosineTable)
 	// sign isn't important for cosines
 	if latInt < 0 {
 		latInt = -latInt
@@ -599,6 +1191,20 @@ func cosineEstimate(latInt int) float64 {
 	return cosineTable[latInt]
 }
 
+// cosineInterpolated estimates the cosine of a fractional latitude
+// by interpolating linearly between our cosineTable entries, which is
+// more accurate than cosineEstimate but a little slower.
+func cosineInterpolated(lat float64) float64 {
+	lat = math.Min(math.Abs(lat), 90)
+	floor := math.Floor(lat)
+	below := cosineEstimate(int(floor))
+	if floor == 90 {
+		return below
+	}
+	above := cosineEstimate(int(floor) + 1)
+	return below + (above-below)*(lat-floor)
+}
+
 // generateCosineTable creates a lookup table
 // for fast estimation of the cos trig function
 func generateCosineTable() {
@@ -631,10 +1237,6 @@ func proximityForSort(meanLat float64, latD float64, lonD float64) float64 {
 // projection, and rough radius of the earth figure.
 // Inspite of all these issues, it should provide a
 // decent ball-park figure.
-func proximity(proxForSort float64, units string) float64 {
-	proxDegrees := math.Sqrt(proxForSort)
-	if units == "mi" {
-		return proxDegrees * MilesPerDegree
-	}
-	return proxDegrees * KmPerDegree
+func proximity(proxForSort float64, units Units) float64 {
+	return math.Sqrt(proxForSort) * units.perDegree()
 }
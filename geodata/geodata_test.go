@@ -6,9 +6,25 @@
 package geodata
 
 import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -107,6 +123,13 @@ func TestPeano(t *testing.T) {
 
 func PopulateData(lat float64, lon float64, delta float64, count int) *GeoData {
 	geo := new(GeoData)
+	populateSpiral(geo, lat, lon, delta, count)
+	return geo
+}
+
+// populateSpiral imports a spiral of records into an existing GeoData,
+// e.g. one configured by NewGeoData
+func populateSpiral(geo *GeoData, lat float64, lon float64, delta float64, count int) {
 	var headerPos HeaderPosition
 	bearing := 'N'
 	// 1 is for the header line
@@ -125,9 +148,46 @@ func PopulateData(lat float64, lon float64, delta float64, count int) *GeoData {
 		}
 	}
 	geo.PopulateIndexes("test")
+	mustValidate(geo)
+}
+
+// mustValidate panics if either of the indexes is inconsistent
+func mustValidate(geo *GeoData) {
+	for _, index := range []*PeanoIndex{geo.peanoIndex1, geo.peanoIndex2} {
+		if err := index.Validate(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// populateLines creates a GeoData configured by any options from data
+// lines in the order ID, Title, Description, URL, Bitmap, Lat, Lon
+func populateLines(lines [][]string, opts ...Option) *GeoData {
+	geo, err := NewGeoData(opts...)
+	if err != nil {
+		panic(err)
+	}
+	var headerPos HeaderPosition
+	header := []string{"ID", "Title", "Description", "URL", "Bitmap", "Lat", "Lon"}
+	for i, line := range append([][]string{header}, lines...) {
+		if err := geo.ImportLine(&headerPos, line, i+1); err != nil {
+			panic(err)
+		}
+	}
+	geo.PopulateIndexes("test")
+	mustValidate(geo)
 	return geo
 }
 
+// resultIDs lists the IDs of the results in order, to compare them
+func resultIDs(res Results) []string {
+	var ids []string
+	for _, rec := range res {
+		ids = append(ids, rec.ID)
+	}
+	return ids
+}
+
 func TestLogic(t *testing.T) {
 	expect := 2
 	geo := PopulateData(0.0, 0.0, 0.0001, expect)
@@ -172,3 +232,1012 @@ func Spiral(bearing rune, lat, lon, delta float64, i int) (rune, float64, float6
 	}
 	return bearing, lat, lon
 }
+
+// TestCurveEnds ascends from near the top of the curve and descends
+// from near the bottom, confirming the walks stop at the ends
+// rather than wrapping around to the other end of the curve.
+func TestCurveEnds(t *testing.T) {
+	pi := NewPeanoIndex()
+	for p := Peano(10); p <= 100; p += 10 {
+		pi.InsertNoReplace(p)
+	}
+	pi.Process()
+
+	walk := func(walker func(Peano, func(Peano, bool, bool) bool), from Peano) (visited []Peano, lastSeen bool) {
+		walker(from, func(p Peano, first bool, last bool) bool {
+			visited = append(visited, p)
+			lastSeen = last
+			// never voluntarily stop, to prove the walk ends by itself
+			return len(visited) < 100
+		})
+		return visited, lastSeen
+	}
+
+	up, last := walk(pi.AscendGreaterOrEqual, 85)
+	if fmt.Sprint(up) != "[90 100]" || !last {
+		t.Errorf("Ascending from 85 visited %v (last %v) instead of stopping at the top of the curve", up, last)
+	}
+	down, last := walk(pi.DescendLessOrEqual, 15)
+	if fmt.Sprint(down) != "[10]" || !last {
+		t.Errorf("Descending from 15 visited %v (last %v) instead of stopping at the bottom of the curve", down, last)
+	}
+	if up, _ := walk(pi.AscendGreaterOrEqual, 101); len(up) != 0 {
+		t.Errorf("Ascending from beyond the top of the curve visited %v", up)
+	}
+	if down, _ := walk(pi.DescendLessOrEqual, 5); len(down) != 0 {
+		t.Errorf("Descending from below the bottom of the curve visited %v", down)
+	}
+	if up, _ := walk(pi.AscendGreaterOrEqual, 50); fmt.Sprint(up) != "[50 60 70 80 90 100]" {
+		t.Errorf("Ascending from an existing peano visited %v", up)
+	}
+}
+
+// TestEmpty searches a GeoData with no records, which should
+// return no results rather than panicking
+func TestEmpty(t *testing.T) {
+	geo := new(GeoData)
+	if res := geo.Find(0, 0, 0, 20, "km", "test"); len(res) != 0 {
+		t.Errorf("Got %d results before any indexes were populated", len(res))
+	}
+	geo.PopulateIndexes("test")
+	if res := geo.Find(51.5, -0.1, 0, 20, "km", "test"); len(res) != 0 {
+		t.Errorf("Got %d results from an empty index", len(res))
+	}
+	result := geo.peanoIndex1.binarySearch(CalcPeano(51.5, -0.1), 0, -1)
+	if result.found || result.prevIndex != noLink || result.nextIndex != noLink {
+		t.Errorf("Binary search of an empty index returned %+v", result)
+	}
+}
+
+// TestFindErrors checks FindE returns each sentinel error in the right scenario
+func TestFindErrors(t *testing.T) {
+	if _, err := new(GeoData).FindE(0, 0, 0, 20, "km", "test"); !errors.Is(err, ErrNoData) {
+		t.Errorf("Got error %v instead of ErrNoData with no data", err)
+	}
+
+	geo := PopulateData(0.0, 0.0, 0.01, 1000)
+	nan, inf := math.NaN(), math.Inf(1)
+	for _, coords := range [][2]float64{{90.1, 0}, {-91, 0}, {0, 180.5}, {0, -181}, {nan, 0}, {0, nan}, {inf, 0}, {0, -inf}} {
+		if _, err := geo.FindE(coords[0], coords[1], 0, 20, "km", "test"); !errors.Is(err, ErrInvalidCoordinates) {
+			t.Errorf("Got error %v instead of ErrInvalidCoordinates searching at %v", err, coords)
+		}
+	}
+
+	res, err := geo.FindE(0, 0, 0, 20, "km", "test")
+	if err != nil || len(res) != 20 {
+		t.Errorf("Got error %v and %d results searching a dense area", err, len(res))
+	}
+
+	// only the last of a line of records has bit 1 set,
+	// so the walks should give up around the origin before reaching it
+	lines := [][]string{}
+	for i := 0; i < 500; i++ {
+		lines = append(lines, []string{fmt.Sprintf("%d", i), "", "", "", fmt.Sprintf("%d", i/499), "0", fmt.Sprintf("%0.2f", float64(i)/100)})
+	}
+	geo = populateLines(lines)
+	res, err = geo.FindE(0, 0, 1, 20, "km", "test")
+	if !errors.Is(err, ErrPartialResults) {
+		t.Errorf("Got error %v instead of ErrPartialResults searching for a rare flag", err)
+	}
+	if len(res) >= 20 {
+		t.Errorf("Got %d results from a partial search", len(res))
+	}
+}
+
+// TestRecall measures the average fraction of the true nearest neighbours
+// (according to the FindExact oracle) which the fast peano curve walks
+// recover, over a set of random searches of a clustered random dataset.
+// Keep an eye on this number when changing PeanoBits or the offset.
+func TestRecall(t *testing.T) {
+	recCnt := 100000
+	searches := 500
+	expect := uint64(20)
+	rng := rand.New(rand.NewPCG(1, 2))
+	geo := populateClustered(rng, recCnt, 35, 60, -10, 30)
+
+	recall := 0.0
+	for range searches {
+		lat := 35 + rng.Float64()*25
+		lon := -10 + rng.Float64()*40
+		recall += measureRecall(geo, geo.Find(lat, lon, 0, expect, "km", "test"), lat, lon, 0, expect)
+	}
+	recall /= float64(searches)
+	t.Logf("Average recall of the %d nearest records over %d searches of %d records: %0.1f%%", expect, searches, recCnt, 100*recall)
+	// a floor to catch gross regressions in accuracy
+	if recall < 0.8 {
+		t.Errorf("Average recall %0.1f%% has dropped below 80%%", 100*recall)
+	}
+}
+
+// TestSingleCurveRecall compares the recall of walking only the primary
+// curve with the default of both curves, on the dataset of TestRecall
+func TestSingleCurveRecall(t *testing.T) {
+	recCnt := 100000
+	searches := 500
+	expect := uint64(20)
+	rng := rand.New(rand.NewPCG(1, 2))
+	geo := populateClustered(rng, recCnt, 35, 60, -10, 30)
+
+	both, single := 0.0, 0.0
+	for range searches {
+		lat := 35 + rng.Float64()*25
+		lon := -10 + rng.Float64()*40
+		both += measureRecall(geo, geo.Find(lat, lon, 0, expect, "km", "test"), lat, lon, 0, expect)
+		single += measureRecall(geo, geo.Find(lat, lon, 0, expect, "km", "test", WithSingleCurve()), lat, lon, 0, expect)
+	}
+	both /= float64(searches)
+	single /= float64(searches)
+	t.Logf("Average recall of the %d nearest records over %d searches: %0.1f%% with both curves, %0.1f%% with a single curve", expect, searches, 100*both, 100*single)
+	if single >= both {
+		t.Errorf("A single curve's recall %0.1f%% isn't below both curves' %0.1f%%", 100*single, 100*both)
+	}
+	// a floor to catch gross regressions in accuracy
+	if single < 0.6 {
+		t.Errorf("Average single curve recall %0.1f%% has dropped below 60%%", 100*single)
+	}
+}
+
+// measureRecall returns the fraction of the exact nearest records found in res
+func measureRecall(geo *GeoData, res Results, lat, lon float64, bitmask uint64, max uint64) float64 {
+	exact := geo.FindExact(lat, lon, bitmask, max, "km")
+	if len(exact) == 0 {
+		return 1
+	}
+	found := make(map[string]bool)
+	for _, rec := range res {
+		found[rec.ID] = true
+	}
+	hits := 0
+	for _, rec := range exact {
+		if found[rec.ID] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(exact))
+}
+
+// populateClustered creates a GeoData of random records inside the input bounds,
+// mostly clustered around random "towns" like real world data, with the rest
+// scattered evenly across the "countryside", configured by any options.
+func populateClustered(rng *rand.Rand, count int, minLat, maxLat, minLon, maxLon float64, opts ...Option) *GeoData {
+	bounds := Bounds{MinLat: minLat, MaxLat: maxLat, MinLon: minLon, MaxLon: maxLon}
+	return populateLines(clusteredLines(rng, count, bounds), opts...)
+}
+
+// RandomDataset returns the data lines of count random records inside
+// the bounds, clustered like those of populateClustered, which are the
+// same for the same seed, so benchmarks and recall tests are reproducible
+func RandomDataset(seed uint64, count int, bounds Bounds) [][]string {
+	return clusteredLines(rand.New(rand.NewPCG(seed, seed)), count, bounds)
+}
+
+// clusteredLines returns the data lines of populateClustered
+// in the order ID, Title, Description, URL, Bitmap, Lat, Lon
+func clusteredLines(rng *rand.Rand, count int, bounds Bounds) [][]string {
+	minLat, maxLat, minLon, maxLon := bounds.MinLat, bounds.MaxLat, bounds.MinLon, bounds.MaxLon
+	towns := make([][2]float64, 50)
+	for i := range towns {
+		towns[i] = [2]float64{minLat + rng.Float64()*(maxLat-minLat), minLon + rng.Float64()*(maxLon-minLon)}
+	}
+	lines := make([][]string, 0, count)
+	for i := range count {
+		var lat, lon float64
+		if rng.IntN(5) == 0 {
+			lat = minLat + rng.Float64()*(maxLat-minLat)
+			lon = minLon + rng.Float64()*(maxLon-minLon)
+		} else {
+			town := towns[rng.IntN(len(towns))]
+			lat = max(minLat, min(maxLat, town[0]+rng.NormFloat64()*0.2))
+			lon = max(minLon, min(maxLon, town[1]+rng.NormFloat64()*0.2))
+		}
+		lines = append(lines, []string{fmt.Sprintf("%d", i), "", "", "", fmt.Sprintf("%d", rng.Uint64()), fmt.Sprintf("%0.6f", lat), fmt.Sprintf("%0.6f", lon)})
+	}
+	return lines
+}
+
+// TestRandomDataset generates the same records from the same seed,
+// and different records from a different seed, inside the bounds
+func TestRandomDataset(t *testing.T) {
+	bounds := Bounds{MinLat: 49, MaxLat: 59, MinLon: -8, MaxLon: 2}
+	first := RandomDataset(42, 1000, bounds)
+	if second := RandomDataset(42, 1000, bounds); !reflect.DeepEqual(first, second) {
+		t.Errorf("The same seed generated different datasets")
+	}
+	if other := RandomDataset(43, 1000, bounds); reflect.DeepEqual(first, other) {
+		t.Errorf("A different seed generated the same dataset")
+	}
+	if len(first) != 1000 {
+		t.Errorf("Generated %d records instead of 1000", len(first))
+	}
+
+	geo := populateLines(first)
+	stats := geo.Stats()
+	inside := stats.Bounds.MinLat >= 49 && stats.Bounds.MaxLat <= 59 && stats.Bounds.MinLon >= -8 && stats.Bounds.MaxLon <= 2
+	if stats.RecordCount != 1000 || !inside {
+		t.Errorf("Imported %d records within %v, outside %v", stats.RecordCount, stats.Bounds, bounds)
+	}
+}
+
+// TestNearest compares Nearest with the top result of FindExact
+// over a regular grid of records, every other one with bit 1 set
+func TestNearest(t *testing.T) {
+	lines := [][]string{}
+	for i := range 100 {
+		for j := range 100 {
+			id := i*100 + j
+			lines = append(lines, []string{fmt.Sprintf("%d", id), "", "", "", fmt.Sprintf("%d", id%2), fmt.Sprintf("%0.2f", 50+float64(i)/100), fmt.Sprintf("%0.2f", float64(j)/100)})
+		}
+	}
+	geo := populateLines(lines)
+	rng := rand.New(rand.NewPCG(3, 4))
+	misses := 0
+	for range 100 {
+		lat := 50 + rng.Float64()
+		lon := rng.Float64()
+		for _, bitmask := range []uint64{0, 1} {
+			nearest, found := geo.Nearest(lat, lon, bitmask, "km")
+			exact := geo.FindExact(lat, lon, bitmask, 1, "km")
+			if !found {
+				t.Errorf("Nearest to %0.6f, %0.6f with bitmask %d found nothing", lat, lon, bitmask)
+			} else if nearest.ID != exact[0].ID {
+				misses++
+				t.Logf("Nearest to %0.6f, %0.6f with bitmask %d was %v instead of %v", lat, lon, bitmask, nearest, exact[0])
+				// but it should still be one of the neighbours of the nearest
+				if nearest.Distance > exact[0].Distance+1.5 {
+					t.Errorf("Nearest was %0.3fkm further than the exact nearest", nearest.Distance-exact[0].Distance)
+				}
+			}
+		}
+	}
+	// We don't test for 100% here, because the peano curves are approximate.
+	t.Logf("Nearest missed the exact nearest record %d times out of 200", misses)
+	if misses > 10 {
+		t.Errorf("Nearest missed the exact nearest record more than 5%% of the time")
+	}
+	if _, found := geo.Nearest(50.5, 0.5, 1<<20, "km"); found {
+		t.Errorf("Nearest found a record matching a bitmask no record has")
+	}
+}
+
+// TestImportQuoting imports RFC 4180 quoted fields, containing commas,
+// quotes and newlines, with the columns in an unusual order
+func TestImportQuoting(t *testing.T) {
+	csv := `Lon,Title,ID,Description,Bitmap,URL,Lat
+-0.1,"Fish, chips & ""mushy"" peas",1,"First line
+second line",1,https://example.com/1,51.5
+"-0.2",,"2","",0x2,"",51.6
+`
+	path := filepath.Join(t.TempDir(), "quoted.csv")
+	if err := os.WriteFile(path, []byte(csv), 0644); err != nil {
+		t.Fatalf("Failed to write CSV: %s", err)
+	}
+	geo := new(GeoData)
+	if err := geo.Import(path, "test"); err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	if len(geo.records) != 2 {
+		t.Fatalf("Imported %d records, expected 2", len(geo.records))
+	}
+	rec := geo.records[0]
+	if rec.ID != "1" || rec.Title != `Fish, chips & "mushy" peas` ||
+		rec.Description != "First line\nsecond line" || rec.URL != "https://example.com/1" ||
+		rec.Bitmap != 1 || rec.Lat != 51.5 || rec.Lon != -0.1 {
+		t.Errorf("First record imported as %+v", rec)
+	}
+	rec = geo.records[1]
+	if rec.ID != "2" || rec.Title != "" || rec.Bitmap != 2 || rec.Lat != 51.6 || rec.Lon != -0.2 {
+		t.Errorf("Second record imported as %+v", rec)
+	}
+}
+
+// TestImportShortRow checks short rows and missing headers are errors
+func TestImportShortRow(t *testing.T) {
+	var headerPos HeaderPosition
+	geo := new(GeoData)
+	geo.ImportLine(&headerPos, []string{"ID", "Title", "Description", "URL", "Bitmap", "Lat", "Lon"}, 1)
+	err := geo.ImportLine(&headerPos, []string{"1", "Title", "", "", "0", "51.5"}, 2)
+	if err == nil || err.Error() != "Line 2 has 6 columns, expected at least 7" {
+		t.Errorf("Got error %v for a short row", err)
+	}
+
+	err = new(GeoData).ImportLine(&HeaderPosition{}, []string{"ID", "Title", "Description", "URL", "Bitmap", "Lat"}, 1)
+	if err == nil || !strings.Contains(err.Error(), "'Lon'") {
+		t.Errorf("Got error %v for a missing header", err)
+	}
+}
+
+// TestImportNonFinite checks NaN and infinite coordinates are errors,
+// rather than indexed with garbage peano codes
+func TestImportNonFinite(t *testing.T) {
+	for _, coords := range [][2]string{{"NaN", "0"}, {"0", "nan"}, {"Inf", "0"}, {"0", "-Inf"}, {"+Infinity", "0"}} {
+		var headerPos HeaderPosition
+		geo := new(GeoData)
+		geo.ImportLine(&headerPos, []string{"ID", "Title", "Description", "URL", "Bitmap", "Lat", "Lon"}, 1)
+		err := geo.ImportLine(&headerPos, []string{"1", "Title", "", "", "0", coords[0], coords[1]}, 2)
+		if err == nil || !strings.Contains(err.Error(), "not a finite number") {
+			t.Errorf("Got error %v importing lat %s, lon %s", err, coords[0], coords[1])
+		}
+	}
+}
+
+// TestImportShortRowFile checks a short row in a CSV file fails
+// the import with a descriptive error, rather than a panic
+func TestImportShortRowFile(t *testing.T) {
+	csv := `ID,Title,Description,URL,Bitmap,Lat,Lon,Score
+1,First,,,0,51.5,-0.1,3
+2,No score,,,0,51.6,-0.2
+3,Truncated,,,0,51.7
+`
+	path := filepath.Join(t.TempDir(), "short.csv")
+	if err := os.WriteFile(path, []byte(csv), 0644); err != nil {
+		t.Fatalf("Failed to write CSV: %s", err)
+	}
+	geo := new(GeoData)
+	err := geo.Import(path, "test")
+	if err == nil || err.Error() != "Line 4 has 6 columns, expected at least 7" {
+		t.Errorf("Got error %v for a short row", err)
+	}
+	// the rows before the short row were fine, including the
+	// one without the trailing optional score
+	if len(geo.records) != 2 || geo.records[0].Score != 3 || geo.records[1].Score != 0 {
+		t.Errorf("Imported records %+v before the short row", geo.records)
+	}
+}
+
+// TestCosineInterpolated compares distances using the interpolated
+// and truncated cosines against the exact cosine, for points 1 degree
+// of longitude apart at a latitude near the top of a whole degree
+func TestCosineInterpolated(t *testing.T) {
+	lat := 45.9
+	reference := math.Cos(lat*math.Pi/180) * KmPerDegree
+	rec := Record{Lat: lat, Lon: 1}
+
+	interpolated := DistanceFast.distance(lat, 0, rec.Lat, rec.Lon, "km")
+	truncated := proximity(proximityForSort(lat, 0, 1), "km")
+
+	if math.Abs(interpolated-reference) > 0.01 {
+		t.Errorf("Interpolated distance %0.4fkm differs from the reference %0.4fkm", interpolated, reference)
+	}
+	if math.Abs(truncated-reference) < 1 {
+		t.Errorf("Expected the truncated distance %0.4fkm to be over 1km out from %0.4fkm", truncated, reference)
+	}
+	for _, lat := range []float64{-90, -45.5, 0, 0.5, 89.99, 90} {
+		if got, want := cosineInterpolated(lat), math.Cos(lat*math.Pi/180); math.Abs(got-want) > 0.0001 {
+			t.Errorf("Interpolated cosine of %0.2f was %0.6f, expected %0.6f", lat, got, want)
+		}
+	}
+}
+
+// TestSortHighLatitude checks the sort estimate scales the longitude by
+// the cosine of the mid latitude, so near the Arctic circle, where a
+// degree of longitude is about a third of a degree of latitude, FindExact
+// finds the nearest records, and Find orders its results by distance
+func TestSortHighLatitude(t *testing.T) {
+	var lines [][]string
+	for i := range 20 {
+		for j := range 20 {
+			lat := 69.9 + float64(i)*0.01
+			lon := 24.7 + float64(j)*0.031
+			lines = append(lines, []string{fmt.Sprintf("%d-%d", i, j), "", "", "", "1", fmt.Sprintf("%0.6f", lat), fmt.Sprintf("%0.6f", lon)})
+		}
+	}
+	geo := populateLines(lines)
+
+	for _, search := range [][2]float64{{70.0, 25.0}, {69.95, 24.9}, {70.05, 25.2}} {
+		distance := func(lat, lon float64) float64 {
+			return DistanceHaversine.distance(search[0], search[1], lat, lon, "km")
+		}
+		var distances []float64
+		for _, rec := range geo.records {
+			distances = append(distances, distance(rec.Lat, rec.Lon))
+		}
+		slices.Sort(distances)
+		tenth := distances[9]
+
+		for _, rec := range geo.FindExact(search[0], search[1], 0, 10, "km") {
+			if d := distance(rec.Lat, rec.Lon); d > tenth*1.01 {
+				t.Errorf("FindExact found %s %0.3fkm from %v, beyond the 10th nearest at %0.3fkm", rec.ID, d, search, tenth)
+			}
+		}
+		res := geo.Find(search[0], search[1], 0, 10, "km", "release")
+		if !slices.IsSortedFunc(res, func(a, b ResultRecord) int { return cmp.Compare(a.Distance, b.Distance) }) {
+			t.Errorf("Find's results near %v aren't ordered by distance: %v", search, res)
+		}
+	}
+}
+
+// TestCosineTableRace searches from many goroutines at once before the
+// cosine table is generated, which the race detector checks with -race
+func TestCosineTableRace(t *testing.T) {
+	geo := PopulateData(51.5, -0.1, 0.001, 100)
+	cosineTable, cosineTableOnce = nil, sync.Once{}
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if res := geo.Find(51.5, -0.1, 0, 10, "km", "release"); len(res) != 10 {
+				t.Errorf("Got %d results instead of 10", len(res))
+			}
+			if got := cosineEstimate(60); math.Abs(got-0.5) > 1e-9 {
+				t.Errorf("Estimated the cosine of 60 as %f", got)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// TestSearchWidth checks a wider search finds more of the nearest
+// records matching a bitmask which few records match
+func TestSearchWidth(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	lines := [][]string{}
+	for i := range 20000 {
+		// 1 in 50 records match
+		bitmap := 1
+		if i%50 == 0 {
+			bitmap = 2
+		}
+		lines = append(lines, []string{fmt.Sprintf("%d", i), "", "", "", fmt.Sprintf("%d", bitmap), fmt.Sprintf("%0.6f", 50+rng.Float64()*5), fmt.Sprintf("%0.6f", rng.Float64()*5)})
+	}
+	narrow := populateLines(lines)
+	wide := populateLines(lines)
+	narrow.width = 1
+	wide.width = 64
+
+	var narrowRecall, wideRecall float64
+	searches := 50
+	expect := uint64(10)
+	for range searches {
+		lat, lon := 50+rng.Float64()*5, rng.Float64()*5
+		narrowRecall += measureRecall(narrow, narrow.Find(lat, lon, 2, expect, "km", "test"), lat, lon, 2, expect)
+		wideRecall += measureRecall(wide, wide.Find(lat, lon, 2, expect, "km", "test"), lat, lon, 2, expect)
+	}
+	narrowRecall /= float64(searches)
+	wideRecall /= float64(searches)
+	t.Logf("Recall with search width 1: %0.1f%%, 64: %0.1f%%", 100*narrowRecall, 100*wideRecall)
+	if wideRecall <= narrowRecall {
+		t.Errorf("A wider search didn't improve recall")
+	}
+}
+
+// TestImportReader imports from an in-memory reader, including a gzip stream
+func TestImportReader(t *testing.T) {
+	csv := "ID,Title,Description,URL,Bitmap,Lat,Lon\n" +
+		"1,First,,,1,51.5,-0.1\n" +
+		"2,Second,,,2,51.6,-0.2\n"
+
+	geo := new(GeoData)
+	if err := geo.ImportReader(strings.NewReader(csv), "test"); err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	res := geo.Find(51.6, -0.2, 0, 2, "km", "test")
+	if len(res) != 2 || res[0].ID != "2" {
+		t.Errorf("Got results %v from the imported reader", res)
+	}
+
+	var zipped bytes.Buffer
+	writer := gzip.NewWriter(&zipped)
+	writer.Write([]byte(csv))
+	writer.Close()
+	reader, err := gzip.NewReader(&zipped)
+	if err != nil {
+		t.Fatalf("Failed to read gzip - %s", err)
+	}
+	geo = new(GeoData)
+	if err := geo.ImportReader(reader, "test"); err != nil {
+		t.Fatalf("Import from gzip failed: %s", err)
+	}
+	if len(geo.records) != 2 {
+		t.Errorf("Imported %d records from gzip, expected 2", len(geo.records))
+	}
+}
+
+// TestDecodePeano checks decoding a peano code lands within a cell
+// of the encoded coordinates, across a grid covering the world
+func TestDecodePeano(t *testing.T) {
+	for _, bits := range []int{PeanoBits, 10} {
+		cellLat, cellLon := PeanoCellDegrees(bits)
+		for lat := -90.0; lat <= 90; lat += 0.37 {
+			for lon := -180.0; lon <= 180; lon += 0.73 {
+				decodedLat, decodedLon := decodePeanoBits(calcPeanoBits(lat, lon, bits), bits)
+				if math.Abs(decodedLat-lat) > cellLat || math.Abs(decodedLon-lon) > cellLon {
+					t.Fatalf("%d bit peano of %0.6f, %0.6f decoded to %0.6f, %0.6f", bits, lat, lon, decodedLat, decodedLon)
+				}
+			}
+		}
+	}
+	// and the public default resolution
+	lat, lon := DecodePeano(CalcPeano(51.5, -0.1))
+	if math.Abs(lat-51.5) > 0.003 || math.Abs(lon+0.1) > 0.003 {
+		t.Errorf("Peano of 51.5, -0.1 decoded to %0.6f, %0.6f", lat, lon)
+	}
+}
+
+// TestCellResolution checks the cells shrink toward the poles,
+// from about 600m at the equator with the default bits
+func TestCellResolution(t *testing.T) {
+	if equator := CellResolution(0); math.Abs(equator-611) > 1 {
+		t.Errorf("Got a resolution of %0.1fm at the equator", equator)
+	}
+	previous := math.Inf(1)
+	for _, lat := range []float64{0, 30, 51.5, 60, 80, 89} {
+		resolution := CellResolution(lat)
+		if resolution >= previous || resolution <= 0 {
+			t.Errorf("Got a resolution of %0.1fm at %0.1f, after %0.1fm", resolution, lat, previous)
+		}
+		if south := CellResolution(-lat); math.Abs(south-resolution) > 1e-9 {
+			t.Errorf("Got a resolution of %0.1fm at %0.1f but %0.1fm at %0.1f", resolution, lat, south, -lat)
+		}
+		previous = resolution
+	}
+	if got := CellResolution(60); math.Abs(got-CellResolution(0)/2) > 1e-6 {
+		t.Errorf("Got a resolution of %0.1fm at 60 degrees, not half that at the equator", got)
+	}
+
+	// each bit fewer doubles the size of the cells
+	geo, err := NewGeoData(WithPeanoBits(14))
+	if err != nil {
+		t.Fatalf("Failed to create GeoData: %s", err)
+	}
+	if got := geo.CellResolution(51.5); math.Abs(got-4*CellResolution(51.5)) > 1e-6 {
+		t.Errorf("Got a resolution of %0.1fm with 14 bits", got)
+	}
+}
+
+// TestDigitiseDegrees checks the digitised coordinates are distinct and
+// monotonic from pole to pole, and don't wrap around at the extremes
+func TestDigitiseDegrees(t *testing.T) {
+	south, _ := digitiseDegrees(-90, 0)
+	equator, _ := digitiseDegrees(0, 0)
+	north, _ := digitiseDegrees(90, 0)
+	if south != 16384 || equator != 32768 || north != 49152 {
+		t.Errorf("Digitised -90, 0, +90 lat to %d, %d, %d", south, equator, north)
+	}
+	// latitudes and longitudes share a scale
+	if _, lon := digitiseDegrees(0, 90); lon != north {
+		t.Errorf("Digitised +90 lon to %d, but +90 lat to %d", lon, north)
+	}
+
+	var prevLat, prevLon uint16
+	for deg := -180.0; deg <= 180; deg += 0.001 {
+		lat16, lon16 := digitiseDegrees(deg, deg)
+		if deg > -180 && (lat16 < prevLat || lon16 < prevLon) {
+			t.Fatalf("Digitised %0.3f to %d, %d, below %d, %d", deg, lat16, lon16, prevLat, prevLon)
+		}
+		prevLat, prevLon = lat16, lon16
+	}
+	lat16, lon16 := digitiseDegrees(180, 180)
+	if lat16 != math.MaxUint16 || lon16 != math.MaxUint16 {
+		t.Errorf("Digitised +180 to %d, %d rather than the maximum", lat16, lon16)
+	}
+	if lat16, lon16 := digitiseDegrees(-180, -180); lat16 != 0 || lon16 != 0 {
+		t.Errorf("Digitised -180 to %d, %d rather than 0", lat16, lon16)
+	}
+}
+
+// TestValidateIndex checks Validate detects a corrupted index
+func TestValidateIndex(t *testing.T) {
+	geo := PopulateData(51.5, -0.1, 0.01, 1000)
+	index := geo.peanoIndex1
+	if err := index.Validate(); err != nil {
+		t.Fatalf("Valid index failed validation - %s", err)
+	}
+
+	// point a link at the wrong neighbour
+	peano := index.Peanos[10]
+	links := index.Links[peano]
+	index.Links[peano] = [2]int{links[0], links[1] + 1}
+	if err := index.Validate(); err == nil {
+		t.Errorf("Validate didn't detect a corrupted link")
+	}
+	index.Links[peano] = links
+
+	// shrink a range
+	prefix := index.prefix(peano)
+	minmax := index.ranges[prefix]
+	index.ranges[prefix] = [2]int{minmax[0] + 1, minmax[1]}
+	if err := index.Validate(); err == nil {
+		t.Errorf("Validate didn't detect a corrupted range")
+	}
+	index.ranges[prefix] = minmax
+
+	// swap two peanos out of order
+	index.Peanos[10], index.Peanos[11] = index.Peanos[11], index.Peanos[10]
+	if err := index.Validate(); err == nil {
+		t.Errorf("Validate didn't detect peanos out of order")
+	}
+}
+
+// TestRangeSearch checks rangeSearch narrows the binary search to
+// exactly the slice indexes of the peanos sharing the high bits
+func TestRangeSearch(t *testing.T) {
+	index := NewPeanoIndex()
+	// inserted out of order, with the prefixes 0x0001, 0x0002 and 0x0100,
+	// whose low bits would be nonsense as slice indexes
+	for _, p := range []Peano{0x0002ffff, 0x00010005, 0x01000000, 0x00020001, 0x00010000, 0x0002f000, 0x0001ffff} {
+		index.InsertNoReplace(p)
+	}
+	index.Process()
+
+	tests := []struct {
+		p        Peano
+		min, max int
+	}{
+		{0x00010000, 0, 2},
+		{0x00017777, 0, 2},
+		{0x00020001, 3, 5},
+		{0x0002ffff, 3, 5},
+		{0x01000000, 6, 6},
+		{0x01001234, 6, 6},
+		// an unknown prefix searches everything
+		{0x00030000, 0, 6},
+	}
+	for _, test := range tests {
+		if iMin, iMax := index.rangeSearch(test.p); iMin != test.min || iMax != test.max {
+			t.Errorf("Range of %#x was %d to %d, expected %d to %d", test.p, iMin, iMax, test.min, test.max)
+		}
+	}
+}
+
+// TestRangesSharedPrefix checks the range of a prefix shared by several
+// records' peanos spans all of them, not just the first one inserted
+func TestRangesSharedPrefix(t *testing.T) {
+	// records a few hundred metres apart share the high bits
+	var lines [][]string
+	for i := range 12 {
+		lines = append(lines, []string{strconv.Itoa(i), "", "", "", "1", fmt.Sprintf("%0.3f", 51.5+float64(i%4)*0.006), fmt.Sprintf("%0.3f", -0.1+float64(i/4)*0.006)})
+	}
+	geo := populateLines(lines)
+	index := geo.peanoIndex1
+
+	counts := make(map[uint32]int)
+	for _, rec := range geo.records {
+		counts[index.prefix(rec.Peano1)]++
+	}
+	shared := false
+	for prefix, minmax := range index.ranges {
+		for i := minmax[0]; i <= minmax[1]; i++ {
+			if index.prefix(index.Peanos[i]) != prefix {
+				t.Errorf("Range %#x from %d to %d includes peano %#x", prefix, minmax[0], minmax[1], index.Peanos[i])
+			}
+		}
+		distinct := minmax[1] - minmax[0] + 1
+		if distinct > 1 {
+			shared = true
+		}
+		if distinct > counts[prefix] {
+			t.Errorf("Range %#x spans %d peanos of %d records", prefix, distinct, counts[prefix])
+		}
+	}
+	// every peano is within the range of its prefix
+	for i, peano := range index.Peanos {
+		if minmax := index.ranges[index.prefix(peano)]; i < minmax[0] || i > minmax[1] {
+			t.Errorf("Peano %#x at %d is outside its range %v", peano, i, minmax)
+		}
+	}
+	if !shared {
+		t.Fatalf("No prefix was shared by several peanos")
+	}
+	if res := geo.Find(51.5, -0.1, 0, 12, "km", "test"); len(res) != 12 {
+		t.Errorf("Found %d of the 12 records", len(res))
+	}
+}
+
+// TestIndexTimings checks the time taken by each pass of building
+// the indexes is logged in debug mode, but not in release mode
+func TestIndexTimings(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	geo := new(GeoData)
+	populateSpiral(geo, 51.5, -0.1, 0.001, 100)
+	for _, mode := range []string{"debug", "release"} {
+		buf.Reset()
+		geo.PopulateIndexes(mode)
+		logged := buf.String()
+		for _, curve := range []string{"Index 1 built in ", "Index 2 built in "} {
+			if strings.Contains(logged, curve) != (mode == "debug") {
+				t.Errorf("Logged in %s mode: %s", mode, logged)
+			}
+		}
+		if mode == "debug" && !regexp.MustCompile(`sort \S+, links \S+, ranges \S+`).MatchString(logged) {
+			t.Errorf("No breakdown of the timings logged: %s", logged)
+		}
+	}
+}
+
+// TestSingleRecord checks the lone record of a single record
+// index is found by any search, without exhausting the walk
+func TestSingleRecord(t *testing.T) {
+	geo := populateLines([][]string{{"only", "", "", "", "1", "51.5", "-0.1"}})
+	if geo.peanoIndex1.Len() != 1 {
+		t.Fatalf("Expected a single peano in the index, got %d", geo.peanoIndex1.Len())
+	}
+	for _, search := range [][2]float64{{51.5, -0.1}, {51.6, -0.2}, {-40, 170}, {0, 0}} {
+		res, err := geo.FindE(search[0], search[1], 0, 20, "km", "test")
+		if err != nil {
+			t.Errorf("Search at %v returned error %v", search, err)
+		}
+		if len(res) != 1 || res[0].ID != "only" {
+			t.Errorf("Search at %v returned %v", search, res)
+		}
+	}
+	if nearest, found := geo.Nearest(51.5, -0.1, 1, "km"); !found || nearest.ID != "only" {
+		t.Errorf("Nearest didn't find the only record")
+	}
+}
+
+// TestImportProgress checks the progress callback is called every
+// so many rows, not counting the header
+func TestImportProgress(t *testing.T) {
+	csv := "ID,Title,Description,URL,Bitmap,Lat,Lon\n"
+	for i := range 25 {
+		csv += fmt.Sprintf("%d,,,,1,51.5,-0.1\n", i)
+	}
+	var counts []int
+	geo, err := NewGeoData(WithProgress(10, func(rows int) {
+		counts = append(counts, rows)
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create a GeoData - %s", err)
+	}
+	if err := geo.ImportReader(strings.NewReader(csv), "test"); err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	if !slices.Equal(counts, []int{10, 20}) {
+		t.Errorf("Progress was reported at %v rows instead of 10 and 20", counts)
+	}
+}
+
+// TestImportBitmapBases imports decimal, hex and binary bitmaps,
+// with and without a configured bitmap base
+func TestImportBitmapBases(t *testing.T) {
+	tests := []struct {
+		base   int
+		bitmap string
+		expect uint64
+	}{
+		{0, "10", 10},
+		{0, "0xff", 255},
+		{0, "0b1010", 10},
+		{0, "0o17", 15},
+		{2, "1010", 10},
+		{2, "0b11", 3},
+		{10, "1010", 1010},
+		{16, "ff", 255},
+		{16, "0xFF", 255},
+	}
+	for _, test := range tests {
+		var opts []Option
+		if test.base != 0 {
+			opts = append(opts, WithBitmapBase(test.base))
+		}
+		geo, _ := NewGeoData(opts...)
+		csv := "ID,Title,Description,URL,Bitmap,Lat,Lon\n1,,,," + test.bitmap + ",51.5,-0.1\n"
+		if err := geo.ImportReader(strings.NewReader(csv), "test"); err != nil {
+			t.Errorf("Failed to import bitmap '%s' in base %d - %s", test.bitmap, test.base, err)
+			continue
+		}
+		if bitmap := geo.records[0].Bitmap; bitmap != test.expect {
+			t.Errorf("Imported bitmap '%s' in base %d as %d instead of %d", test.bitmap, test.base, bitmap, test.expect)
+		}
+	}
+
+	geo, _ := NewGeoData(WithBitmapBase(2))
+	csv := "ID,Title,Description,URL,Bitmap,Lat,Lon\n1,,,,12,51.5,-0.1\n"
+	if err := geo.ImportReader(strings.NewReader(csv), "test"); err == nil {
+		t.Errorf("No error importing a bitmap which isn't binary in base 2")
+	}
+}
+
+// TestFindNearID checks the anchor record is left out of the
+// results, and its neighbours are ranked by distance from it
+func TestFindNearID(t *testing.T) {
+	geo := populateLines([][]string{
+		{"far", "", "", "", "1", "51.5", "-0.2"},
+		{"anchor", "", "", "", "1", "51.5", "-0.1"},
+		{"near", "", "", "", "1", "51.5", "-0.11"},
+		{"nearer", "", "", "", "2", "51.5", "-0.104"},
+	})
+
+	res, err := geo.FindNearID("anchor", 0, 3, "km")
+	if err != nil {
+		t.Fatalf("FindNearID failed - %s", err)
+	}
+	var got []string
+	for _, rec := range res {
+		got = append(got, rec.ID)
+	}
+	if !slices.Equal(got, []string{"nearer", "near", "far"}) {
+		t.Errorf("Got %v near the anchor", got)
+	}
+
+	// the anchor needn't match the bitmask
+	res, _ = geo.FindNearID("nearer", 1, 1, "km")
+	if len(res) != 1 || res[0].ID != "anchor" {
+		t.Errorf("Got %v near a record not matching the bitmask", res)
+	}
+
+	if _, err := geo.FindNearID("nowhere", 0, 3, "km"); !errors.Is(err, ErrUnknownID) {
+		t.Errorf("Expected ErrUnknownID for an unknown ID, got %v", err)
+	}
+}
+
+// TestFindWithinRadius returns only the records within the radius,
+// even with room for more, and the nearest of them when there isn't
+func TestFindWithinRadius(t *testing.T) {
+	geo := populateLines([][]string{
+		{"1", "", "", "", "1", "51.505", "-0.1"},
+		{"2", "", "", "", "1", "51.51", "-0.1"},
+		{"3", "", "", "", "1", "51.515", "-0.1"},
+		{"4", "", "", "", "1", "51.55", "-0.1"},
+		{"5", "", "", "", "1", "51.6", "-0.1"},
+		{"6", "", "", "", "1", "51.7", "-0.2"},
+	})
+
+	res, err := geo.FindWithinRadius(51.5, -0.1, 2, 0, 10, "km")
+	if err != nil {
+		t.Fatalf("FindWithinRadius failed - %s", err)
+	}
+	if len(res) != 3 || res[0].ID != "1" || res[2].ID != "3" {
+		t.Errorf("Got %v within 2km instead of the 3 nearest", res)
+	}
+	for _, rec := range res {
+		if rec.Distance > 2 {
+			t.Errorf("Record %s is %0.3fkm away, beyond the radius", rec.ID, rec.Distance)
+		}
+	}
+
+	res, _ = geo.FindWithinRadius(51.5, -0.1, 2, 0, 2, "km")
+	if len(res) != 2 || res[1].ID != "2" {
+		t.Errorf("Got %v within 2km with a max of 2", res)
+	}
+
+	res, err = geo.FindWithinRadius(51.5, -0.1, 0.1, 0, 10, "km")
+	if err != nil || len(res) != 0 {
+		t.Errorf("Got %v, %v within 100m, expected none", res, err)
+	}
+
+	if _, err := geo.FindWithinRadius(51.5, -0.1, 0, 0, 10, "km"); err == nil {
+		t.Errorf("Expected an error for a zero radius")
+	}
+}
+
+// TestRecordByID looks up records by their ID
+func TestRecordByID(t *testing.T) {
+	geo := populateLines([][]string{
+		{"first", "First", "", "", "1", "51.5", "-0.1"},
+		{"second", "Second", "", "", "2", "51.6", "-0.2"},
+		{"first", "Repeated", "", "", "4", "51.7", "-0.3"},
+	})
+	if rec, found := geo.Record("second"); !found || rec.Title != "Second" || rec.Lat != 51.6 {
+		t.Errorf("Got %v looking up a record by its ID", rec)
+	}
+	if rec, _ := geo.Record("first"); rec.Title != "First" {
+		t.Errorf("Got %v instead of the first record with a repeated ID", rec)
+	}
+	if _, found := geo.Record("third"); found {
+		t.Errorf("Found a record with an unknown ID")
+	}
+}
+
+// TestEqualDistanceOrder checks co-located records are always
+// returned in the same order, by their ID
+func TestEqualDistanceOrder(t *testing.T) {
+	lines := [][]string{}
+	for _, id := range []string{"m", "c", "x", "a", "q", "b", "z", "k"} {
+		lines = append(lines, []string{id, "", "", "", "1", "51.5", "-0.1"})
+	}
+	geo := populateLines(lines)
+
+	expect := []string{"a", "b", "c", "k", "m", "q", "x", "z"}
+	for range 20 {
+		var got []string
+		for _, rec := range geo.Find(51.6, -0.1, 0, 8, "km", "release") {
+			got = append(got, rec.ID)
+		}
+		if !slices.Equal(got, expect) {
+			t.Fatalf("Got co-located records in the order %v instead of %v", got, expect)
+		}
+	}
+	var exact []string
+	for _, rec := range geo.FindExact(51.6, -0.1, 0, 3, "km") {
+		exact = append(exact, rec.ID)
+	}
+	if !slices.Equal(exact, expect[:3]) {
+		t.Errorf("FindExact got co-located records in the order %v instead of %v", exact, expect[:3])
+	}
+}
+
+// TestImportURL imports from an HTTP server, plain and gzip encoded
+func TestImportURL(t *testing.T) {
+	csv := "ID,Title,Description,URL,Bitmap,Lat,Lon\n" +
+		"1,First,,,1,51.5,-0.1\n" +
+		"2,Second,,,2,51.6,-0.2\n"
+	var zipped bytes.Buffer
+	writer := gzip.NewWriter(&zipped)
+	writer.Write([]byte(csv))
+	writer.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/data.csv":
+			w.Write([]byte(csv))
+		case "/zipped.csv":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(zipped.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/data.csv", "/zipped.csv"} {
+		geo := new(GeoData)
+		if err := geo.ImportURL(server.URL+path, "test"); err != nil {
+			t.Fatalf("Import from %s failed: %s", path, err)
+		}
+		if res := geo.Find(51.6, -0.2, 0, 2, "km", "test"); len(res) != 2 || res[0].ID != "2" {
+			t.Errorf("Got results %v imported from %s", res, path)
+		}
+	}
+
+	err := new(GeoData).ImportURL(server.URL+"/missing.csv", "test")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected a 404 error importing a missing URL, got %v", err)
+	}
+
+	// a server which never finishes the response times out
+	stalled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(csv))
+		w.(http.Flusher).Flush()
+		<-stalled
+	}))
+	defer slow.Close()
+	defer close(stalled)
+	geo, err := NewGeoData(WithImportTimeout(50 * time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create a GeoData - %s", err)
+	}
+	if err := geo.ImportURL(slow.URL, "test"); err == nil || !errors.Is(err, ErrImportRead) {
+		t.Errorf("Expected a read error importing from a stalled server, got %v", err)
+	}
+}
+
+// TestImportMeta checks unrecognised columns are kept as
+// each record's meta, and returned with the results
+func TestImportMeta(t *testing.T) {
+	csv := "ID,Phone,Title,Description,URL,Bitmap,Lat,Lon,Hours\n" +
+		"1,+44 20 7946 0000,Cafe,,,1,51.5,-0.1,9-5\n" +
+		"2,,Park,,,2,51.6,-0.2,\n"
+	geo := new(GeoData)
+	if err := geo.ImportReader(strings.NewReader(csv), "test"); err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	res := geo.Find(51.5, -0.1, 0, 2, "km", "test")
+	if len(res) != 2 {
+		t.Fatalf("Got %d results instead of 2", len(res))
+	}
+	expect := map[string]string{"Phone": "+44 20 7946 0000", "Hours": "9-5"}
+	if !reflect.DeepEqual(res[0].Meta, expect) {
+		t.Errorf("Got meta %v instead of %v", res[0].Meta, expect)
+	}
+	if res[1].Meta != nil {
+		t.Errorf("Got meta %v for a record with empty extra columns", res[1].Meta)
+	}
+
+	encoded, err := json.Marshal(res)
+	if err != nil {
+		t.Fatalf("Failed to encode results: %s", err)
+	}
+	if got := string(encoded); !strings.Contains(got, `"meta":{"Hours":"9-5","Phone":"+44 20 7946 0000"}`) || strings.Count(got, `"meta"`) != 1 {
+		t.Errorf("Got JSON %s", got)
+	}
+	// changing a result's meta leaves the record's alone
+	res[0].Meta["Hours"] = "closed"
+	if rec, _ := geo.Record("1"); rec.Meta["Hours"] != "9-5" {
+		t.Errorf("Changing a result's meta changed the record's to %v", rec.Meta)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Results should present as GeoJSON points, with their lon first
+func TestGeoJSON(t *testing.T) {
+	res := Results{{ID: "a", Title: "A", Lat: 51.5, Lon: -0.1, Distance: 0.5, Units: "km"}}
+	encoded, err := json.Marshal(res.GeoJSON())
+	if err != nil {
+		t.Fatalf("Failed to encode GeoJSON - %s", err)
+	}
+	expected := `{"type":"FeatureCollection","features":[{"type":"Feature","id":"a",` +
+		`"geometry":{"type":"Point","coordinates":[-0.1,51.5]},` +
+		`"properties":{"id":"a","title":"A","description":"","url":"","bitmap":0,"lat":51.5,"lon":-0.1,"score":0,"distance":0.5,"units":"km"}}]}`
+	if string(encoded) != expected {
+		t.Errorf("Got GeoJSON %s", encoded)
+	}
+	if encoded, _ := json.Marshal(Results(nil).GeoJSON()); string(encoded) != `{"type":"FeatureCollection","features":[]}` {
+		t.Errorf("Got GeoJSON %s for no results", encoded)
+	}
+}
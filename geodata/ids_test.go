@@ -0,0 +1,105 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"regexp"
+	"testing"
+)
+
+// importIDs imports the lines with the ID strategy,
+// returning the IDs of the records in order
+func importIDs(t *testing.T, strategy IDStrategy, lines [][]string) []string {
+	geo, err := NewGeoData(WithIDStrategy(strategy))
+	if err != nil {
+		t.Fatalf("Failed to create GeoData: %s", err)
+	}
+	var headerPos HeaderPosition
+	header := []string{"ID", "Title", "Description", "URL", "Bitmap", "Lat", "Lon"}
+	for i, line := range append([][]string{header}, lines...) {
+		if err := geo.ImportLine(&headerPos, line, i+1); err != nil {
+			t.Fatalf("Import failed: %s", err)
+		}
+	}
+	ids := make([]string, len(geo.records))
+	for i, rec := range geo.records {
+		ids[i] = rec.ID
+	}
+	return ids
+}
+
+var idLines = [][]string{
+	{"", "Cafe", "", "", "1", "51.5", "-0.1"},
+	{"", "Pub", "", "", "1", "51.5", "-0.1"},
+	{"explicit", "Park", "", "", "1", "51.6", "-0.2"},
+	{"", "Cafe", "", "", "1", "51.7", "-0.3"},
+}
+
+// TestIDLineNumber generates IDs from the line numbers by default
+func TestIDLineNumber(t *testing.T) {
+	ids := importIDs(t, IDLineNumber, idLines)
+	if ids[0] != "2" || ids[1] != "3" || ids[2] != "explicit" || ids[3] != "5" {
+		t.Errorf("Got IDs %v", ids)
+	}
+}
+
+// TestIDUUID generates a unique random UUID for each record without an ID
+func TestIDUUID(t *testing.T) {
+	ids := importIDs(t, IDUUID, idLines)
+	again := importIDs(t, IDUUID, idLines)
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := make(map[string]bool)
+	for i, id := range append(ids, again...) {
+		if i%len(idLines) == 2 {
+			if id != "explicit" {
+				t.Errorf("Got ID %s instead of the explicit ID", id)
+			}
+			continue
+		}
+		if !uuid.MatchString(id) {
+			t.Errorf("ID %s isn't a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Errorf("ID %s was generated twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+// TestIDHash generates the same IDs across re-imports, even when
+// the lines move, and different IDs for different records
+func TestIDHash(t *testing.T) {
+	ids := importIDs(t, IDHash, idLines)
+	// a new line above the others, and the coordinates written differently
+	moved := [][]string{
+		{"", "Pub", "", "", "1", "51.50", "-0.10"},
+		{"", "New", "", "", "1", "52", "0"},
+		{"", "Cafe", "", "", "2", "51.5", "-0.1"},
+	}
+	again := importIDs(t, IDHash, moved)
+	if again[0] != ids[1] || again[2] != ids[0] {
+		t.Errorf("Got IDs %v after re-importing, expected %s and %s", again, ids[1], ids[0])
+	}
+	if ids[2] != "explicit" {
+		t.Errorf("Got ID %s instead of the explicit ID", ids[2])
+	}
+	// the same title elsewhere, or a different title at the same place
+	if ids[0] == ids[1] || ids[0] == ids[3] || len(ids[0]) != 16 {
+		t.Errorf("Got IDs %v, expected 16 hex digits distinct for each record", ids)
+	}
+}
+
+// TestParseIDStrategy checks the names of the ID strategies
+func TestParseIDStrategy(t *testing.T) {
+	for name, expected := range map[string]IDStrategy{"": IDLineNumber, "line": IDLineNumber, "uuid": IDUUID, "hash": IDHash} {
+		if strategy, err := ParseIDStrategy(name); err != nil || strategy != expected {
+			t.Errorf("Got %v, %v parsing '%s'", strategy, err, name)
+		}
+	}
+	if _, err := ParseIDStrategy("random"); err == nil {
+		t.Errorf("Expected an error parsing an unknown ID strategy")
+	}
+}
@@ -12,7 +12,9 @@ package geodata
 
 import (
 	"cmp"
+	"fmt"
 	"slices"
+	"time"
 )
 
 // PeanoIndex loosely follows the interface of llrb
@@ -28,19 +30,37 @@ type PeanoIndex struct {
 	// Links is effectively a linked list pointing at the slice index
 	// of the previous peano and next peano in the Peanos slice,
 	// to make moving forward and backwards along a peano curve
-	// much faster.
+	// much faster.  The two ends of the curve link to noLink.
 	Links map[Peano][2]int
 	// Ranges stores the max and min slice index over a particular range
 	// being the high 16bits of the peano code,
 	// which could cut down the binary search space
-	// by 2**16
+	// by 2**16.  With fewer RangeBits it's keyed by those
+	// high bits instead, and with more it's left empty,
+	// because they don't fit its keys.
 	Ranges map[uint16][2]int
+	// RangeBits is the number of high bits of the peano codes
+	// grouped into each of the ranges, or 0 for DefaultRangeBits.
+	// It must be set before Process.
+	RangeBits int
+	// ranges is Ranges keyed by up to MaxRangeBits high bits,
+	// which the searches use
+	ranges map[uint32][2]int
 }
 
 // var maxPeano = uint32(math.Pow(2, 32) - 1)
 // var minPeano = 0
 
-const max16bit = 65536
+// By default, the Ranges group the peano codes by their high 16 bits
+const DefaultRangeBits = 16
+
+// The most high bits the Ranges can group peano codes by, beyond
+// which there would be nearly as many ranges as peanos
+const MaxRangeBits = 24
+
+// noLink marks the ends of the curve in Links, and a
+// missing previous or next peano in binaryResults
+const noLink = -1
 
 // NewPeanoIndex returns a pointer to
 // a new PeanoIndex struct.
@@ -49,6 +69,15 @@ func NewPeanoIndex() *PeanoIndex {
 	return &pi
 }
 
+// Len returns the number of distinct peano codes in the index,
+// which is zero for an empty or nil index.
+func (pi *PeanoIndex) Len() int {
+	if pi == nil {
+		return 0
+	}
+	return len(pi.Peanos)
+}
+
 // InsertNoReplace inserts a new peano code
 // into the index, but note that it won't be
 // searchable until Process() is run.
@@ -56,83 +85,182 @@ func (pi *PeanoIndex) InsertNoReplace(p Peano) {
 	pi.Peanos = append(pi.Peanos, p)
 }
 
+// indexTimings breaks down how long Process took, to see
+// which part is worth optimising for large datasets
+type indexTimings struct {
+	sort   time.Duration
+	links  time.Duration
+	ranges time.Duration
+}
+
 // Process creates the "indexed linked-list" data structure
 // by creating an index link between the elements
 // already marked with 1's by InsertNoReplace().
 func (pi *PeanoIndex) Process() {
+	pi.process()
+}
+
+// process is Process, timing each of its passes
+func (pi *PeanoIndex) process() indexTimings {
+	var timings indexTimings
+	start := time.Now()
 
 	// sort the peanos
 	slices.SortFunc(pi.Peanos, func(a, b Peano) int {
 		return cmp.Compare(uint32(a), uint32(b))
 	})
+	timings.sort = time.Since(start)
+	start = time.Now()
 
-	// populate the Links & Ranges
-	pi.Links = make(map[Peano][2]int)
-	pi.Ranges = make(map[uint16][2]int)
+	// populate the Links
+	pi.Links = make(map[Peano][2]int, len(pi.Peanos))
 
 	imax := len(pi.Peanos) - 1
 
-	// if we have only one peano (or zero), there won't be any links or ranges
-	if imax <= 0 {
-		return
+	for i, peano := range pi.Peanos {
+		// The first and last links terminate the curve (a single
+		// peano is both) rather than wrapping around the globe,
+		// because wrapping would walk on into records at the far
+		// end of the curve.
+		links := [2]int{i - 1, i + 1}
+		if i == 0 {
+			links[0] = noLink
+		}
+		if i == imax {
+			links[1] = noLink
+		}
+		pi.Links[peano] = links
 	}
+	timings.links = time.Since(start)
+	start = time.Now()
 
-	// Populate the first and last links, which wrap around the globe.
-	// (Hopefully not a subtle mistake which e.g. infinitely loops
-	// the binarySearch...)
-	pi.Links[pi.Peanos[0]] = [2]int{imax, 1}
-	pi.Links[pi.Peanos[imax]] = [2]int{imax - 1, 0}
+	// and the Ranges
+	pi.processRanges()
+	timings.ranges = time.Since(start)
 
+	return timings
+}
+
+// processRanges populates the Ranges and ranges from the sorted Peanos,
+// e.g. again after loading a saved index, which leaves out the ranges
+func (pi *PeanoIndex) processRanges() {
+	pi.ranges = make(map[uint32][2]int)
 	for i, peano := range pi.Peanos {
-		if i > 0 && i < imax {
-			pi.Links[peano] = [2]int{i - 1, i + 1}
-		}
-		high16 := highBits(peano)
-		minmax, exists := pi.Ranges[high16]
+		prefix := pi.prefix(peano)
+		minmax, exists := pi.ranges[prefix]
 		if exists {
-			pi.Ranges[high16] = [2]int{minmax[0], i}
+			pi.ranges[prefix] = [2]int{minmax[0], i}
 		} else {
-			pi.Ranges[high16] = [2]int{i, i}
+			pi.ranges[prefix] = [2]int{i, i}
 		}
 	}
+	pi.Ranges = make(map[uint16][2]int)
+	if pi.rangeBits() <= 16 {
+		for prefix, minmax := range pi.ranges {
+			pi.Ranges[uint16(prefix)] = minmax
+		}
+	}
+}
+
+// Validate checks the Links and Ranges created by Process are consistent
+// with the sorted Peanos, which can help when debugging accuracy issues.
+// It checks the peanos are in strictly ascending order, the links of each
+// peano point at its neighbours in the slice (or noLink at the ends), and
+// each Ranges entry bounds exactly the peanos sharing its high bits.
+func (pi *PeanoIndex) Validate() error {
+	if pi.Len() == 0 {
+		return nil
+	}
+	imax := len(pi.Peanos) - 1
+	if len(pi.Links) != len(pi.Peanos) {
+		return fmt.Errorf("Index has %d links for %d peanos", len(pi.Links), len(pi.Peanos))
+	}
+	ranges := 0
+	for i, peano := range pi.Peanos {
+		if i > 0 && pi.Peanos[i-1] >= peano {
+			return fmt.Errorf("Peano %d at index %d doesn't follow %d", peano, i, pi.Peanos[i-1])
+		}
 
-	return
+		links, exists := pi.Links[peano]
+		want := [2]int{i - 1, i + 1}
+		if i == 0 {
+			want[0] = noLink
+		}
+		if i == imax {
+			want[1] = noLink
+		}
+		if !exists || links != want {
+			return fmt.Errorf("Peano %d at index %d links to %v, expected %v", peano, i, links, want)
+		}
+
+		// check each range once, at its first peano
+		prefix := pi.prefix(peano)
+		if i > 0 && pi.prefix(pi.Peanos[i-1]) == prefix {
+			continue
+		}
+		ranges++
+		last := i
+		for last < imax && pi.prefix(pi.Peanos[last+1]) == prefix {
+			last++
+		}
+		if minmax := pi.ranges[prefix]; minmax != [2]int{i, last} {
+			return fmt.Errorf("Range %d is %v, expected %v", prefix, minmax, [2]int{i, last})
+		}
+		if minmax, exists := pi.Ranges[uint16(prefix)]; pi.rangeBits() <= 16 && (!exists || minmax != [2]int{i, last}) {
+			return fmt.Errorf("Exported range %d is %v, expected %v", prefix, minmax, [2]int{i, last})
+		}
+	}
+	if len(pi.ranges) != ranges {
+		return fmt.Errorf("Index has %d ranges, expected %d", len(pi.ranges), ranges)
+	}
+	if pi.rangeBits() <= 16 && len(pi.Ranges) != ranges {
+		return fmt.Errorf("Index has %d exported ranges, expected %d", len(pi.Ranges), ranges)
+	}
+	return nil
 }
 
 // AscendGreaterOrEqual will search for the input peano 'p', and whether it finds
 // it or not will then ascend up the peano curve and find the next peano
 // codes and feed them one by one into the 'iterator' function passed in.
 // The iterator function must return false at some point when enough
-// results have been collected.
-func (pi *PeanoIndex) AscendGreaterOrEqual(p Peano, iterator func(p Peano, first bool) bool) {
+// results have been collected.  Its 'last' argument is true for the
+// final peano at the top of the curve, after which the walk ends.
+func (pi *PeanoIndex) AscendGreaterOrEqual(p Peano, iterator func(p Peano, first bool, last bool) bool) {
 	first := true
 	pi.ascendGreaterOrEqual(p, first, iterator)
 }
 
 // recursive function which exits when the iterator function returns false
+// or the end of the curve is reached.
 // 'first' is just a boolean flag to indicate whether this is the first
 // or subsequent call, which helps us optimise the finding of peano codes.
-func (pi *PeanoIndex) ascendGreaterOrEqual(p Peano, first bool, iterator func(p Peano, first bool) bool) bool {
-	var nextPeano Peano
+func (pi *PeanoIndex) ascendGreaterOrEqual(p Peano, first bool, iterator func(p Peano, first bool, last bool) bool) bool {
+	var next int
 	if first {
 		// Perform our binary search
 		// but first narrow the range
 		iMin, iMax := pi.rangeSearch(p)
 		result := pi.binarySearch(p, iMin, iMax)
 		if result.found {
-			nextPeano = pi.Peanos[result.peanoIndex]
+			next = result.peanoIndex
 		} else {
-			nextPeano = pi.Peanos[result.nextIndex]
+			next = result.nextIndex
 		}
 		first = false
 	} else {
 		// we already performed a binary search
 		// so we can just follow the links upwards
 		links, _ := pi.Links[p]
-		nextPeano = pi.Peanos[links[1]]
+		next = links[1]
+	}
+	// nothing above p on the curve
+	if next == noLink {
+		return false
 	}
+	nextPeano := pi.Peanos[next]
+	last := pi.Links[nextPeano][1] == noLink
 	// base of our recursion
-	if !iterator(nextPeano, first) {
+	if !iterator(nextPeano, first, last) || last {
 		return false
 	}
 	// recurse into this same function
@@ -143,36 +271,44 @@ func (pi *PeanoIndex) ascendGreaterOrEqual(p Peano, first bool, iterator func(p
 // it or not will then descend down the peano curve and find the next peano
 // codes and feed them one by one into the 'iterator' function passed in.
 // The iterator function must return false at some point when enough
-// results have been collected.
-func (pi *PeanoIndex) DescendLessOrEqual(p Peano, iterator func(p Peano, first bool) bool) {
+// results have been collected.  Its 'last' argument is true for the
+// final peano at the bottom of the curve, after which the walk ends.
+func (pi *PeanoIndex) DescendLessOrEqual(p Peano, iterator func(p Peano, first bool, last bool) bool) {
 	first := true
 	pi.descendLessOrEqual(p, first, iterator)
 }
 
-// descendLessOrEqual is a recursive function which exits when the iterator function returns false
+// descendLessOrEqual is a recursive function which exits when the iterator function
+// returns false or the end of the curve is reached.
 // 'first' is just a boolean flag to indicate whether this is the first
 // or subsequent call, which helps us optimise the finding of peano codes.
-func (pi *PeanoIndex) descendLessOrEqual(p Peano, first bool, iterator func(p Peano, first bool) bool) bool {
-	var prevPeano Peano
+func (pi *PeanoIndex) descendLessOrEqual(p Peano, first bool, iterator func(p Peano, first bool, last bool) bool) bool {
+	var prev int
 	if first {
 		// Perform our binary search
 		// but first narrow the range
 		iMin, iMax := pi.rangeSearch(p)
 		result := pi.binarySearch(p, iMin, iMax)
 		if result.found {
-			prevPeano = pi.Peanos[result.peanoIndex]
+			prev = result.peanoIndex
 		} else {
-			prevPeano = pi.Peanos[result.prevIndex]
+			prev = result.prevIndex
 		}
 		first = false
 	} else {
 		// we already performed a binary search
 		// so we can just follow the links downwards
 		links, _ := pi.Links[p]
-		prevPeano = pi.Peanos[links[0]]
+		prev = links[0]
 	}
+	// nothing below p on the curve
+	if prev == noLink {
+		return false
+	}
+	prevPeano := pi.Peanos[prev]
+	last := pi.Links[prevPeano][0] == noLink
 	// base of our recursion
-	if !iterator(prevPeano, first) {
+	if !iterator(prevPeano, first, last) || last {
 		return false
 	}
 	// recurse into this same function
@@ -181,13 +317,12 @@ func (pi *PeanoIndex) descendLessOrEqual(p Peano, first bool, iterator func(p Pe
 
 // The idea here is to save ourselves up to 16 binary searches
 // by subdividing the space into "ranges" each consisting of
-// the high 16 bits of Peano codes.  We precalculate the
-// high and low index positions for each range, so we can
-// give ourselves a headstart when we perform a binary
-// search.
+// the high 16 bits of Peano codes (by default, see RangeBits).
+// We precalculate the high and low index positions for each
+// range, so we can give ourselves a headstart when we perform
+// a binary search.
 func (pi *PeanoIndex) rangeSearch(p Peano) (int, int) {
-	high16 := highBits(p)
-	irange, exists := pi.Ranges[high16]
+	irange, exists := pi.ranges[pi.prefix(p)]
 	if !exists {
 		return 0, len(pi.Peanos) - 1
 	}
@@ -203,42 +338,61 @@ type binaryResults struct {
 
 // binarySearch returns a struct of binaryResults
 // which populates peanoIndex only if the peano is found
-// and populates nextIndex and prevIndex in every case
+// and populates nextIndex and prevIndex in every case,
+// using noLink when there is no peano before or after p.
+// The minIndex to maxIndex window must contain every
+// peano sharing the high bits of p (see rangeSearch).
 func (pi *PeanoIndex) binarySearch(p Peano, minIndex int, maxIndex int) binaryResults {
-	for {
+	// nothing to search
+	if len(pi.Peanos) == 0 {
+		return binaryResults{found: false, prevIndex: noLink, nextIndex: noLink}
+	}
+	for minIndex <= maxIndex {
 		attempt := minIndex + int((maxIndex-minIndex)/2)
 		pAttempt := pi.Peanos[attempt]
 		if pAttempt == p {
-			// Found it! - look up the previous and next indexes
-			links := pi.Links[pAttempt]
+			// Found it! - the previous and next indexes are its neighbours
+			// in the sorted slice
 			res := binaryResults{
 				found:      true,
 				peanoIndex: attempt,
-				prevIndex:  links[0],
-				nextIndex:  links[1],
+				prevIndex:  attempt - 1,
+				nextIndex:  attempt + 1,
+			}
+			if res.nextIndex >= len(pi.Peanos) {
+				res.nextIndex = noLink
 			}
 			return res
 		}
 		if pAttempt > p {
-			maxIndex = attempt
+			maxIndex = attempt - 1
 		} else {
-			minIndex = attempt
-		}
-		if maxIndex-minIndex <= 1 {
-			// The peano could not be found
-			// so return the prev and next links of the attempt
-			links := pi.Links[pAttempt]
-			res := binaryResults{
-				found:     false,
-				prevIndex: links[0],
-				nextIndex: links[1],
-			}
-			return res
+			minIndex = attempt + 1
 		}
 	}
+	// The peano could not be found, and minIndex
+	// is now where it would have been inserted
+	res := binaryResults{
+		found:     false,
+		prevIndex: minIndex - 1,
+		nextIndex: minIndex,
+	}
+	if res.nextIndex >= len(pi.Peanos) {
+		res.nextIndex = noLink
+	}
+	return res
+}
+
+// rangeBits returns the RangeBits, or DefaultRangeBits if unset
+func (pi *PeanoIndex) rangeBits() int {
+	if pi.RangeBits == 0 {
+		return DefaultRangeBits
+	}
+	return pi.RangeBits
 }
 
-func highBits(p Peano) uint16 {
-	// return uint16(uint32(p) / uint32(max16bit))
-	return uint16(uint32(p) >> 16)
+// prefix returns the high RangeBits bits of a peano code,
+// which key the ranges
+func (pi *PeanoIndex) prefix(p Peano) uint32 {
+	return uint32(p) >> (32 - pi.rangeBits())
 }
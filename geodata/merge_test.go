@@ -0,0 +1,73 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestMergeGeoData merges regions either side of the meridian, which
+// searches across the boundary like one GeoData of all the records
+func TestMergeGeoData(t *testing.T) {
+	var west, east, all [][]string
+	for i := range 200 {
+		lat := 51.4 + float64(i/20)*0.01
+		lon := -0.1 + float64(i%20)*0.01
+		line := []string{fmt.Sprintf("%d", i), "", "", "", fmt.Sprintf("%d", 1+i%2), fmt.Sprintf("%0.6f", lat), fmt.Sprintf("%0.6f", lon)}
+		if lon < 0 {
+			west = append(west, line)
+		} else {
+			east = append(east, line)
+		}
+		all = append(all, line)
+	}
+	geo := populateLines(west)
+	combined := populateLines(all)
+
+	if err := geo.Merge(populateLines(east), "test"); err != nil {
+		t.Fatalf("Merge failed - %s", err)
+	}
+	mustValidate(geo)
+	if len(geo.records) != 200 {
+		t.Errorf("Merged %d records instead of 200", len(geo.records))
+	}
+	for _, search := range [][2]float64{{51.45, 0}, {51.41, -0.005}, {51.48, 0.08}} {
+		expected := combined.Find(search[0], search[1], 1, 30, "km", "test")
+		res := geo.Find(search[0], search[1], 1, 30, "km", "test")
+		if !reflect.DeepEqual(res, expected) {
+			t.Errorf("Merged records found %v instead of %v at %v", res, expected, search)
+		}
+		var westFound, eastFound bool
+		for _, rec := range res {
+			westFound = westFound || rec.Lon < 0
+			eastFound = eastFound || rec.Lon >= 0
+		}
+		if search[1] == 0 && !(westFound && eastFound) {
+			t.Errorf("Didn't find records from both sides of the boundary at %v", search)
+		}
+	}
+	if rec, found := geo.Record("15"); !found || rec.Lon < 0 {
+		t.Errorf("Got %v looking up a merged record", rec)
+	}
+
+	if err := geo.Merge(populateLines(east[:1]), "test"); err == nil || !strings.Contains(err.Error(), "which is in both") {
+		t.Errorf("Expected an error merging a repeated ID, got %v", err)
+	}
+	coarse := populateLines([][]string{{"new", "", "", "", "1", "51.5", "0.1"}}, WithPeanoBits(12))
+	if err := geo.Merge(coarse, "test"); err == nil || !strings.Contains(err.Error(), "12 bits into 16 bits") {
+		t.Errorf("Expected an error merging peano codes of different bits, got %v", err)
+	}
+	offset := populateLines([][]string{{"new", "", "", "", "1", "51.5", "0.1"}}, WithOffset(-10, 15))
+	if err := geo.Merge(offset, "test"); err == nil || !strings.Contains(err.Error(), "offset from -10, 15") {
+		t.Errorf("Expected an error merging peano codes of a different offset, got %v", err)
+	}
+	if len(geo.records) != 200 {
+		t.Errorf("A failed merge left %d records instead of 200", len(geo.records))
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+// NearestEach should find the nearest record of each of three
+// categories, compared with FindExact for each category
+func TestNearestEach(t *testing.T) {
+	lines := [][]string{}
+	for i := range 50 {
+		for j := range 50 {
+			id := i*50 + j
+			// one of three categories, plus an unrelated flag
+			bitmap := uint64(1)<<(id%3) | uint64(id%2)<<4
+			lines = append(lines, []string{fmt.Sprintf("%d", id), "", "", "", fmt.Sprintf("%d", bitmap), fmt.Sprintf("%0.2f", 50+float64(i)/100), fmt.Sprintf("%0.2f", float64(j)/100)})
+		}
+	}
+	geo := populateLines(lines)
+	categories := []uint64{1, 2, 4, 8}
+	rng := rand.New(rand.NewPCG(5, 6))
+	misses := 0
+	for range 50 {
+		lat := 50 + rng.Float64()/2
+		lon := rng.Float64() / 2
+		nearest, err := geo.NearestEach(lat, lon, categories, "km")
+		if err != nil {
+			t.Fatalf("NearestEach failed - %s", err)
+		}
+		if len(nearest) != 3 {
+			t.Fatalf("Got %d categories instead of 3, with none in the fourth", len(nearest))
+		}
+		for _, mask := range categories[:3] {
+			rec, found := nearest[mask]
+			exact := geo.FindExact(lat, lon, mask, 1, "km")
+			if !found || rec.Bitmap&mask == 0 {
+				t.Errorf("Nearest of category %d was %v", mask, rec)
+			} else if rec.ID != exact[0].ID {
+				misses++
+				if rec.Distance > exact[0].Distance+1.5 {
+					t.Errorf("Nearest of category %d was %0.3fkm further than the exact nearest", mask, rec.Distance-exact[0].Distance)
+				}
+			}
+		}
+	}
+	// We don't test for 100% here, because the peano curves are approximate.
+	t.Logf("NearestEach missed the exact nearest record %d times out of 150", misses)
+	// 5% of 150 is 7.5
+	if misses > 7 {
+		t.Errorf("NearestEach missed the exact nearest record more than 5%% of the time")
+	}
+
+	for name, invalid := range map[string][]uint64{
+		"a zero mask":       {1, 0},
+		"overlapping masks": {3, 2},
+	} {
+		if _, err := geo.NearestEach(50.1, 0.1, invalid, "km"); err == nil {
+			t.Errorf("No error finding the nearest of each category with %s", name)
+		}
+	}
+}
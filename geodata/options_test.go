@@ -0,0 +1,387 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestNewGeoDataDefaults checks a GeoData from NewGeoData with no
+// options searches exactly like one created with new(GeoData)
+func TestNewGeoDataDefaults(t *testing.T) {
+	geo, err := NewGeoData()
+	if err != nil {
+		t.Fatalf("Failed to create a default GeoData - %s", err)
+	}
+	populateSpiral(geo, 0.0, 0.0, 0.0001, 100)
+	plain := PopulateData(0.0, 0.0, 0.0001, 100)
+
+	res := geo.Find(0, 0, 0, 20, "", "test")
+	plainRes := plain.Find(0, 0, 0, 20, "km", "test")
+	if len(res) != len(plainRes) {
+		t.Fatalf("Got %d results instead of %d results", len(res), len(plainRes))
+	}
+	for i := range res {
+		if !reflect.DeepEqual(res[i], plainRes[i]) {
+			t.Errorf("Result %d was %v instead of %v", i, res[i], plainRes[i])
+		}
+	}
+}
+
+// TestNewGeoDataOptions exercises a couple of valid combinations of options
+func TestNewGeoDataOptions(t *testing.T) {
+	geo, err := NewGeoData(WithPeanoBits(12), WithCurves(1), WithUnits("mi"))
+	if err != nil {
+		t.Fatalf("Failed to create a GeoData - %s", err)
+	}
+	populateSpiral(geo, 0.0, 0.0, 0.0001, 100)
+	if geo.peanoIndex2.Len() != 0 {
+		t.Errorf("Populated the secondary index when configured with a single curve")
+	}
+	res := geo.Find(0, 0, 0, 20, "", "test")
+	if len(res) != 20 {
+		t.Errorf("Got %d results instead of 20 results from a single 12 bit curve", len(res))
+	}
+	if len(res) > 0 && res[0].Units != "mi" {
+		t.Errorf("Got units '%s' instead of the configured default 'mi'", res[0].Units)
+	}
+	if peano := geo.calcPeano(89.9, 179.9); peano >= 1<<24 {
+		t.Errorf("Peano code %d doesn't fit in 24 bits", peano)
+	}
+
+	geo, err = NewGeoData(WithOffset(-10.1234, 15.4321), WithPeanoBits(16))
+	if err != nil {
+		t.Fatalf("Failed to create a GeoData - %s", err)
+	}
+	populateSpiral(geo, 0.0, 0.0, 0.0001, 100)
+	if res := geo.Find(0, 0, 0, 20, "km", "test"); len(res) != 20 {
+		t.Errorf("Got %d results instead of 20 results with a custom offset", len(res))
+	}
+	if geo.calcPeanoOffset(0, 0) != CalcPeano(-10.1234, 15.4321) {
+		t.Errorf("The secondary curve doesn't use the custom offset")
+	}
+}
+
+// TestNewGeoDataInvalid checks bad options and combinations are rejected
+func TestNewGeoDataInvalid(t *testing.T) {
+	invalid := map[string][]Option{
+		"zero bits":                  {WithPeanoBits(0)},
+		"too many bits":              {WithPeanoBits(PeanoBits + 1)},
+		"zero curves":                {WithCurves(0)},
+		"three curves":               {WithCurves(3)},
+		"unknown units":              {WithUnits("furlongs")},
+		"offset off the map":         {WithOffset(91, 0)},
+		"offset with a single curve": {WithCurves(1), WithOffset(10, 10)},
+		"zero offset":                {WithOffset(0, 0)},
+		"zero search width":          {WithSearchWidth(0)},
+		"zero cluster fraction":      {WithClusterWarning(0)},
+		"zero progress rows":         {WithProgress(0, func(int) {})},
+		"nil progress callback":      {WithProgress(10, nil)},
+		"base 3 bitmaps":             {WithBitmapBase(3)},
+		"too few candidates":         {WithMaxCandidates(3)},
+		"negative distance decimals": {WithDistanceDecimals(-1)},
+		"too many snap decimals":     {WithSnapDecimals(MaxSnapDecimals + 1)},
+		"unknown column header":      {WithColumnNames(map[string]string{"phone": "Phone"})},
+		"zero range bits":            {WithRangeBits(0)},
+		"too many range bits":        {WithRangeBits(MaxRangeBits + 1)},
+		"unknown ID strategy":        {WithIDStrategy(IDHash + 1)},
+		"missing index cache":        {WithIndexCache("/nonexistent")},
+		"empty latitude band":        {WithLatitudeBand(10, 10)},
+		"latitude band off the map":  {WithLatitudeBand(-91, 60)},
+	}
+	for name, opts := range invalid {
+		if _, err := NewGeoData(opts...); err == nil {
+			t.Errorf("No error creating a GeoData with %s", name)
+		}
+	}
+}
+
+// TestLogLevel checks a quiet log level silences debug output,
+// even in debug mode
+func TestLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	geo, err := NewGeoData(WithLogLevel(LogQuiet))
+	if err != nil {
+		t.Fatalf("Failed to create a GeoData - %s", err)
+	}
+	geo.PopulateIndexes("debug")
+	if buf.Len() > 0 {
+		t.Errorf("Got debug output at a quiet log level: %s", buf.String())
+	}
+
+	geo, _ = NewGeoData(WithLogLevel(LogDebug))
+	geo.PopulateIndexes("release")
+	if buf.Len() == 0 {
+		t.Errorf("Got no debug output at a debug log level")
+	}
+
+	if _, err := ParseLogLevel("chatty"); err == nil {
+		t.Errorf("No error parsing an unknown log level")
+	}
+}
+
+// TestDistanceDecimals checks the result distances are rounded
+func TestDistanceDecimals(t *testing.T) {
+	find := func(opts ...Option) float64 {
+		geo, err := NewGeoData(opts...)
+		if err != nil {
+			t.Fatalf("Failed to create a GeoData - %s", err)
+		}
+		geo.ImportReader(strings.NewReader("ID,Title,Description,URL,Bitmap,Lat,Lon\n1,,,,1,51.612345,-0.1\n"), "test")
+		return geo.Find(51.5, -0.1, 0, 1, "km", "release")[0].Distance
+	}
+	raw := find(WithDistanceDecimals(MaxDistanceDecimals))
+	for _, places := range []int{0, 1, 3} {
+		scale := math.Pow10(places)
+		if got, expect := find(WithDistanceDecimals(places)), math.Round(raw*scale)/scale; got != expect {
+			t.Errorf("Got a distance of %f rounded to %d places instead of %f", got, places, expect)
+		}
+	}
+	if got := find(); got != math.Round(raw*1000)/1000 || got == raw {
+		t.Errorf("Got a distance of %f instead of %f rounded to 3 places by default", got, raw)
+	}
+}
+
+// Snapping should share peano codes between nearby records,
+// but leave their coordinates and distances alone
+func TestSnapDecimals(t *testing.T) {
+	var csv strings.Builder
+	csv.WriteString("ID,Title,Description,URL,Bitmap,Lat,Lon\n")
+	for i := range 400 {
+		fmt.Fprintf(&csv, "%d,,,,1,%0.4f,%0.4f\n", i, 51.5+float64(i%20)*0.0013, -0.1+float64(i/20)*0.0013)
+	}
+	load := func(opts ...Option) *GeoData {
+		geo, err := NewGeoData(append(opts, WithLogLevel(LogQuiet))...)
+		if err != nil {
+			t.Fatalf("Failed to create a GeoData - %s", err)
+		}
+		if err := geo.ImportReader(strings.NewReader(csv.String()), "test"); err != nil {
+			t.Fatalf("Import failed: %s", err)
+		}
+		return geo
+	}
+	plain, snapped := load(), load(WithSnapDecimals(1))
+	if got, before := snapped.Stats().DistinctPeanos1, plain.Stats().DistinctPeanos1; got >= before {
+		t.Errorf("Snapping gave %d distinct peanos, from %d", got, before)
+	}
+
+	rec, _ := snapped.Record("21")
+	if rec.Lat != 51.5013 || rec.Lon != -0.0987 {
+		t.Errorf("Snapping changed the record's coordinates to %f, %f", rec.Lat, rec.Lon)
+	}
+	// the order of the results may change at a coarse grid,
+	// but each distance is still from the original coordinates
+	distances := make(map[string]float64)
+	for _, rec := range plain.Find(51.5, -0.1, 0, 400, "km", "release") {
+		distances[rec.ID] = rec.Distance
+	}
+	for _, rec := range snapped.Find(51.5, -0.1, 0, 5, "km", "release") {
+		if rec.Distance != distances[rec.ID] {
+			t.Errorf("Snapping changed the distance of %s from %f to %f", rec.ID, distances[rec.ID], rec.Distance)
+		}
+	}
+}
+
+// Differently named CSV columns should be mapped to their headers
+func TestColumnNames(t *testing.T) {
+	geo, err := NewGeoData(WithColumnNames(map[string]string{"Name": "Title", "Rating": "Score"}))
+	if err != nil {
+		t.Fatalf("Failed to create a GeoData - %s", err)
+	}
+	csv := "ID,Name,Description,URL,Bitmap,Lat,Lon,Rating\n1,Cafe,,,1,51.5,-0.1,4.5\n"
+	if err := geo.ImportReader(strings.NewReader(csv), "test"); err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	if rec, _ := geo.Record("1"); rec.Title != "Cafe" || rec.Score != 4.5 || rec.Meta != nil {
+		t.Errorf("Got %+v importing renamed columns", rec)
+	}
+}
+
+// Indexes with coarse and fine ranges should find the same results
+func TestRangeBits(t *testing.T) {
+	var csv strings.Builder
+	csv.WriteString("ID,Title,Description,URL,Bitmap,Lat,Lon\n")
+	rng := rand.New(rand.NewPCG(3, 4))
+	for i := range 5000 {
+		fmt.Fprintf(&csv, "%d,,,,%d,%0.5f,%0.5f\n", i, rng.IntN(4), 49+rng.Float64()*10, -8+rng.Float64()*10)
+	}
+	load := func(bits int) *GeoData {
+		geo, err := NewGeoData(WithRangeBits(bits), WithLogLevel(LogQuiet))
+		if err != nil {
+			t.Fatalf("Failed to create a GeoData - %s", err)
+		}
+		if err := geo.ImportReader(strings.NewReader(csv.String()), "test"); err != nil {
+			t.Fatalf("Import failed: %s", err)
+		}
+		if err := geo.peanoIndex1.Validate(); err != nil {
+			t.Fatalf("Invalid index with %d range bits - %s", bits, err)
+		}
+		return geo
+	}
+	coarse, fine := load(4), load(MaxRangeBits)
+	if len(coarse.peanoIndex1.ranges) >= len(fine.peanoIndex1.ranges) {
+		t.Errorf("Got %d coarse ranges and %d fine ones", len(coarse.peanoIndex1.ranges), len(fine.peanoIndex1.ranges))
+	}
+	// the exported ranges only fit prefixes of up to 16 bits
+	if len(coarse.peanoIndex1.Ranges) != len(coarse.peanoIndex1.ranges) || len(fine.peanoIndex1.Ranges) != 0 {
+		t.Errorf("Got %d coarse and %d fine exported ranges", len(coarse.peanoIndex1.Ranges), len(fine.peanoIndex1.Ranges))
+	}
+	for range 50 {
+		lat, lon := 49+rng.Float64()*10, -8+rng.Float64()*10
+		bitmask := uint64(rng.IntN(4))
+		want := coarse.Find(lat, lon, bitmask, 20, "km", "release")
+		if got := fine.Find(lat, lon, bitmask, 20, "km", "release"); !reflect.DeepEqual(want, got) {
+			t.Errorf("Coarse and fine ranges found different results at %0.4f, %0.4f", lat, lon)
+		}
+	}
+}
+
+// TestSetOffset changes the offset of imported records, which should then
+// search the same as records imported with the offset in the first place
+func TestSetOffset(t *testing.T) {
+	var csv strings.Builder
+	csv.WriteString("ID,Title,Description,URL,Bitmap,Lat,Lon\n")
+	rng := rand.New(rand.NewPCG(5, 6))
+	for i := range 2000 {
+		fmt.Fprintf(&csv, "%d,,,,1,%0.5f,%0.5f\n", i, 49+rng.Float64()*10, -8+rng.Float64()*10)
+	}
+	load := func(opts ...Option) *GeoData {
+		geo, err := NewGeoData(append(opts, WithLogLevel(LogQuiet), WithPeanoCache(10))...)
+		if err != nil {
+			t.Fatalf("Failed to create a GeoData - %s", err)
+		}
+		if err := geo.ImportReader(strings.NewReader(csv.String()), "test"); err != nil {
+			t.Fatalf("Import failed: %s", err)
+		}
+		return geo
+	}
+	geo, offset := load(), load(WithOffset(-10.1234, 15.4321))
+	// fill the peano cache with the codes of the old offset
+	geo.Find(54, -3, 0, 20, "km", "release")
+
+	if err := geo.SetOffset(-10.1234, 15.4321, "test"); err != nil {
+		t.Fatalf("SetOffset failed - %s", err)
+	}
+	mustValidate(geo)
+	for i := range geo.records {
+		if geo.records[i].Peano2 != offset.records[i].Peano2 {
+			t.Fatalf("Record %s has offset peano code %d instead of %d", geo.records[i].ID, geo.records[i].Peano2, offset.records[i].Peano2)
+		}
+	}
+	for _, search := range [][2]float64{{54, -3}, {49.5, -7.5}, {58, 1}} {
+		want := offset.Find(search[0], search[1], 0, 20, "km", "release")
+		if got := geo.Find(search[0], search[1], 0, 20, "km", "release"); !reflect.DeepEqual(got, want) {
+			t.Errorf("Found %v instead of %v at %v after changing the offset", got, want, search)
+		}
+	}
+
+	if err := geo.SetOffset(91, 0, "test"); err == nil {
+		t.Errorf("Expected an error setting an offset off the map")
+	}
+	if lat, lon := geo.offset(); lat != -10.1234 || lon != 15.4321 {
+		t.Errorf("A failed SetOffset changed the offset to %v, %v", lat, lon)
+	}
+}
+
+// TestLatitudeBand rejects records and searches outside the band
+func TestLatitudeBand(t *testing.T) {
+	geo, err := NewGeoData(WithLatitudeBand(-60, 72), WithLogLevel(LogQuiet))
+	if err != nil {
+		t.Fatalf("Failed to create a GeoData - %s", err)
+	}
+	csv := "ID,Title,Description,URL,Bitmap,Lat,Lon\n1,,,,1,51.5,-0.1\n2,,,,1,72,-0.1\n"
+	if err := geo.ImportReader(strings.NewReader(csv), "test"); err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	if res, err := geo.FindE(72, 0, 0, 10, "km", "test"); err != nil || len(res) != 2 {
+		t.Errorf("Got %v and error %v at the edge of the band", res, err)
+	}
+	_, err = geo.FindE(78.2, 15.6, 0, 10, "km", "test")
+	if !errors.Is(err, ErrInvalidCoordinates) || !strings.Contains(err.Error(), "outside the latitude band -60 to 72") {
+		t.Errorf("Expected an error searching above the band, got %v", err)
+	}
+	if _, err := geo.CountNear(-75, 0, 0, 10, "km"); !errors.Is(err, ErrInvalidCoordinates) {
+		t.Errorf("Expected an error counting below the band, got %v", err)
+	}
+	_, err = geo.FindInPolygon([]Point{{70, 0}, {75, 0}, {70, 1}}, 0)
+	if !errors.Is(err, ErrInvalidCoordinates) || !strings.Contains(err.Error(), "outside the latitude band") {
+		t.Errorf("Expected an error searching a polygon above the band, got %v", err)
+	}
+
+	polar, _ := NewGeoData(WithLatitudeBand(-60, 72))
+	err = polar.ImportReader(strings.NewReader(csv+"3,,,,1,78.2,15.6\n"), "test")
+	if err == nil || !strings.Contains(err.Error(), "On line 4 lat '78.2' is outside the latitude band") {
+		t.Errorf("Expected an error importing a record above the band, got %v", err)
+	}
+}
+
+// TestPeanoLayout stores the records in primary peano order,
+// without changing the results of any search
+func TestPeanoLayout(t *testing.T) {
+	geo := populateClustered(rand.New(rand.NewPCG(1, 2)), 20000, 49.0, 59.0, -8.0, 2.0)
+	sorted := populateClustered(rand.New(rand.NewPCG(1, 2)), 20000, 49.0, 59.0, -8.0, 2.0, WithPeanoLayout())
+
+	if !slices.IsSortedFunc(sorted.records, func(a, b Record) int { return cmp.Compare(a.Peano1, b.Peano1) }) {
+		t.Errorf("The records aren't in primary peano order")
+	}
+	if slices.IsSortedFunc(geo.records, func(a, b Record) int { return cmp.Compare(a.Peano1, b.Peano1) }) {
+		t.Errorf("The records are in primary peano order without the option")
+	}
+	for i, rec := range sorted.records {
+		if !slices.Contains(sorted.peanoMap1[rec.Peano1], &sorted.records[i]) || !slices.Contains(sorted.peanoMap2[rec.Peano2], &sorted.records[i]) {
+			t.Fatalf("Record %s isn't mapped to its place in the records", rec.ID)
+		}
+	}
+
+	// crowded records share peanos, so filters skip records part way
+	// through a peano, and the larger max walks the curves in parallel
+	crowded := populateClustered(rand.New(rand.NewPCG(1, 2)), 20000, 51.4, 51.6, -0.2, 0.0)
+	crowdedSorted := populateClustered(rand.New(rand.NewPCG(1, 2)), 20000, 51.4, 51.6, -0.2, 0.0, WithPeanoLayout())
+	searches := []struct {
+		bitmask uint64
+		max     uint64
+		opts    []FindOption
+	}{
+		{0, 20, nil},
+		{1, 20, nil},
+		{6, 20, []FindOption{WithAtLeast(2)}},
+		{0, 20, []FindOption{WithExcludeMask(1), WithRequireMask(8)}},
+		{0, 20, []FindOption{WithMinDistance(1)}},
+		{3, 150, nil},
+	}
+	rng := rand.New(rand.NewPCG(3, 4))
+	for range 100 {
+		lat, lon := 49+rng.Float64()*10, -8+rng.Float64()*10
+		crowdedLat, crowdedLon := 51.4+rng.Float64()/5, -0.2+rng.Float64()/5
+		for _, search := range searches {
+			expected := geo.Find(lat, lon, search.bitmask, search.max, "km", "release", search.opts...)
+			if res := sorted.Find(lat, lon, search.bitmask, search.max, "km", "release", search.opts...); !reflect.DeepEqual(res, expected) {
+				t.Errorf("Found %d different results with bitmask %d at %v, %v", len(res), search.bitmask, lat, lon)
+			}
+			expected = crowded.Find(crowdedLat, crowdedLon, search.bitmask, search.max, "km", "release", search.opts...)
+			if res := crowdedSorted.Find(crowdedLat, crowdedLon, search.bitmask, search.max, "km", "release", search.opts...); !reflect.DeepEqual(res, expected) {
+				t.Errorf("Found %d different crowded results with bitmask %d at %v, %v", len(res), search.bitmask, crowdedLat, crowdedLon)
+			}
+		}
+	}
+	if rec, found := sorted.Record("123"); !found || rec.ID != "123" {
+		t.Errorf("Got %v looking up a record by its ID", rec)
+	}
+}
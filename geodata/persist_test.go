@@ -0,0 +1,110 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSaveLoad restores a saved index, which searches the same
+func TestSaveLoad(t *testing.T) {
+	geo := PopulateData(51.5, -0.1, 0.001, 500)
+	var buf bytes.Buffer
+	if err := geo.Save(&buf); err != nil {
+		t.Fatalf("Save failed - %s", err)
+	}
+	saved := buf.Bytes()
+
+	loaded := new(GeoData)
+	if err := loaded.Load(bytes.NewReader(saved), "test"); err != nil {
+		t.Fatalf("Load failed - %s", err)
+	}
+	mustValidate(loaded)
+	for _, search := range [][2]float64{{51.5, -0.1}, {51.52, -0.13}, {0, 0}} {
+		expected := geo.Find(search[0], search[1], 0, 20, "km", "test")
+		if res := loaded.Find(search[0], search[1], 0, 20, "km", "test"); !reflect.DeepEqual(res, expected) {
+			t.Errorf("Loaded index found %v instead of %v at %v", res, expected, search)
+		}
+	}
+	if rec, found := loaded.Record("250"); !found || rec.Title != "Title 250" {
+		t.Errorf("Got %v looking up a loaded record", rec)
+	}
+
+	coarse, _ := NewGeoData(WithPeanoBits(12))
+	if err := coarse.Load(bytes.NewReader(saved), "test"); err == nil || !strings.Contains(err.Error(), "different options") {
+		t.Errorf("Expected an error loading an index with different options, got %v", err)
+	}
+	if err := new(GeoData).Save(&buf); err == nil {
+		t.Errorf("Expected an error saving an empty GeoData")
+	}
+}
+
+// TestIndexCache imports the identical file a second time from the
+// cached index, but parses a changed file again
+func TestIndexCache(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "places.csv")
+	cacheDir := filepath.Join(dir, "cache")
+	os.Mkdir(cacheDir, 0o755)
+	data := "ID,Title,Description,URL,Bitmap,Lat,Lon\n"
+	for i := range 100 {
+		data += fmt.Sprintf("%d,Place %d,,,1,%0.3f,-0.1\n", i, i, 51.5+float64(i)/1000)
+	}
+	os.WriteFile(csvPath, []byte(data), 0o644)
+
+	importFile := func() *GeoData {
+		logged.Reset()
+		geo, err := NewGeoData(WithIndexCache(cacheDir), WithLogLevel(LogDebug))
+		if err != nil {
+			t.Fatalf("Failed to create GeoData: %s", err)
+		}
+		if err := geo.Import(csvPath, "test"); err != nil {
+			t.Fatalf("Import failed: %s", err)
+		}
+		return geo
+	}
+	cached := func() []string {
+		files, _ := filepath.Glob(filepath.Join(cacheDir, "proximity-*.gob"))
+		return files
+	}
+
+	first := importFile()
+	if strings.Contains(logged.String(), "cached index was loaded") || len(cached()) != 1 {
+		t.Fatalf("The first import didn't parse the file and cache its index: %s", logged.String())
+	}
+	second := importFile()
+	if !strings.Contains(logged.String(), "cached index was loaded") || strings.Contains(logged.String(), "Generating") {
+		t.Errorf("The second import of the identical file didn't use the cached index: %s", logged.String())
+	}
+	expected := first.Find(51.55, -0.1, 0, 10, "km", "test")
+	if res := second.Find(51.55, -0.1, 0, 10, "km", "test"); len(res) != 10 || !reflect.DeepEqual(res, expected) {
+		t.Errorf("The cached index found %v instead of %v", res, expected)
+	}
+
+	os.WriteFile(csvPath, []byte(data+"new,New,,,1,51.6,-0.1\n"), 0o644)
+	changed := importFile()
+	if strings.Contains(logged.String(), "cached index was loaded") || len(cached()) != 2 {
+		t.Errorf("The changed file didn't get a new cached index: %s", logged.String())
+	}
+	if _, found := changed.Record("new"); !found {
+		t.Errorf("The changed file's new record wasn't imported")
+	}
+
+	if _, err := NewGeoData(WithIndexCache(csvPath)); err == nil {
+		t.Errorf("Expected an error for an index cache which isn't a directory")
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// FindInPolygon should find the records inside a concave U shaped
+// polygon, excluding those in the gap between its arms
+func TestFindInPolygon(t *testing.T) {
+	lines := [][]string{}
+	for i := range 10 {
+		for j := range 10 {
+			id := i*10 + j
+			lines = append(lines, []string{fmt.Sprintf("%d", id), "", "", "", fmt.Sprintf("%d", 1+id%2), fmt.Sprintf("%0.2f", 50.05+float64(i)/10), fmt.Sprintf("%0.2f", 0.05+float64(j)/10)})
+		}
+	}
+	geo := populateLines(lines)
+	u := []Point{{50.1, 0.1}, {50.1, 0.9}, {50.9, 0.9}, {50.9, 0.7}, {50.3, 0.7}, {50.3, 0.3}, {50.9, 0.3}, {50.9, 0.1}}
+	inU := func(rec ResultRecord) bool {
+		inBox := rec.Lat > 50.1 && rec.Lat < 50.9 && rec.Lon > 0.1 && rec.Lon < 0.9
+		inGap := rec.Lat > 50.3 && rec.Lon > 0.3 && rec.Lon < 0.7
+		return inBox && !inGap
+	}
+
+	res, err := geo.FindInPolygon(u, 0)
+	if err != nil {
+		t.Fatalf("FindInPolygon failed - %s", err)
+	}
+	// 8 rows of 8 in the box, less 6 rows of 4 in the gap
+	if len(res) != 40 {
+		t.Errorf("Got %d records inside the polygon instead of 40", len(res))
+	}
+	for _, rec := range res {
+		if !inU(rec) {
+			t.Errorf("Record %s at %0.2f, %0.2f is outside the polygon", rec.ID, rec.Lat, rec.Lon)
+		}
+	}
+
+	res, _ = geo.FindInPolygon(u, 2)
+	if len(res) != 20 {
+		t.Errorf("Got %d records inside the polygon with flag 2 instead of 20", len(res))
+	}
+	for _, rec := range res {
+		if rec.Bitmap&2 == 0 {
+			t.Errorf("Record %s doesn't match the bitmask", rec.ID)
+		}
+	}
+	res, _ = geo.FindInPolygon(u, 0, WithExcludeMask(2))
+	if len(res) != 20 {
+		t.Errorf("Got %d records inside the polygon excluding flag 2 instead of 20", len(res))
+	}
+
+	if _, err := geo.FindInPolygon(u[:2], 0); err == nil {
+		t.Errorf("Expected an error for a polygon of 2 points")
+	}
+	if _, err := geo.FindInPolygon([]Point{{91, 0}, {50, 1}, {51, 1}}, 0); !errors.Is(err, ErrInvalidCoordinates) {
+		t.Errorf("Expected ErrInvalidCoordinates for a polygon point with lat 91, got %v", err)
+	}
+	if _, err := new(GeoData).FindInPolygon(u, 0); !errors.Is(err, ErrNoData) {
+		t.Errorf("Expected ErrNoData without records, got %v", err)
+	}
+}
+
+// FindInPolygon should find the records either side of
+// the antimeridian inside a polygon crossing it
+func TestFindInPolygonAntimeridian(t *testing.T) {
+	geo := populateLines([][]string{
+		{"west", "", "", "", "1", "0", "179.5"},
+		{"east", "", "", "", "1", "0.5", "-179.5"},
+		{"far west", "", "", "", "1", "0", "178"},
+		{"far east", "", "", "", "1", "0", "-178"},
+		{"greenwich", "", "", "", "1", "0", "0"},
+	})
+	res, err := geo.FindInPolygon([]Point{{-1, 179}, {-1, -179}, {1, -179}, {1, 179}}, 0)
+	if err != nil {
+		t.Fatalf("FindInPolygon failed - %s", err)
+	}
+	if len(res) != 2 || res[0].ID != "west" || res[1].ID != "east" {
+		t.Errorf("Got %v inside the polygon, instead of west and east", res)
+	}
+}
+
+// FindInPolygonStream should yield the same records as FindInPolygon,
+// one at a time, and stop as soon as the callback returns false
+func TestFindInPolygonStream(t *testing.T) {
+	geo := PopulateData(51.5, -0.1, 0.001, 500)
+	square := []Point{{51.48, -0.12}, {51.48, -0.08}, {51.52, -0.08}, {51.52, -0.12}}
+	all, err := geo.FindInPolygon(square, 0)
+	if err != nil || len(all) < 10 {
+		t.Fatalf("Got %d records and error %v inside the square", len(all), err)
+	}
+
+	var streamed Results
+	err = geo.FindInPolygonStream(square, 0, func(rec ResultRecord) bool {
+		streamed = append(streamed, rec)
+		return true
+	})
+	if err != nil || !reflect.DeepEqual(streamed, all) {
+		t.Errorf("Streamed %d records and error %v instead of the %d found", len(streamed), err, len(all))
+	}
+
+	for _, stop := range []int{1, 5} {
+		calls := 0
+		err = geo.FindInPolygonStream(square, 0, func(rec ResultRecord) bool {
+			calls++
+			if rec.ID != all[calls-1].ID {
+				t.Errorf("Streamed record %s instead of %s", rec.ID, all[calls-1].ID)
+			}
+			return calls < stop
+		})
+		if err != nil || calls != stop {
+			t.Errorf("Streamed %d records and error %v, stopping after %d", calls, err, stop)
+		}
+	}
+
+	if err := geo.FindInPolygonStream(square[:2], 0, func(ResultRecord) bool { return true }); err == nil {
+		t.Errorf("Expected an error streaming a polygon of 2 points")
+	}
+}
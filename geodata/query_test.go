@@ -0,0 +1,545 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// A better scored but further record should only
+// outrank a nearer one when weighting by score
+func TestScoreWeight(t *testing.T) {
+	var headerPos HeaderPosition
+	geo := new(GeoData)
+	lines := [][]string{
+		{"ID", "Title", "Description", "URL", "Bitmap", "Lat", "Lon", "Score"},
+		{"near", "2 stars", "", "", "0", "51.5", "-0.1", "2"},
+		{"far", "5 stars", "", "", "0", "51.5", "-0.12", "5"},
+		{"unscored", "", "", "", "0", "51.5", "-0.2", ""},
+	}
+	for i, line := range lines {
+		if err := geo.ImportLine(&headerPos, line, i+1); err != nil {
+			t.Fatalf("Import failed: %s", err)
+		}
+	}
+	geo.PopulateIndexes("release")
+
+	res := geo.Find(51.5, -0.1, 0, 3, "km", "release")
+	if got := resultIDs(res); len(got) != 3 || got[0] != "near" || got[1] != "far" {
+		t.Errorf("Unweighted results should be ordered by distance, got %v", got)
+	}
+	if res[1].Score != 5 || res[2].Score != 0 {
+		t.Errorf("Scores not returned, got %f and %f", res[1].Score, res[2].Score)
+	}
+
+	// the far record is ~1.4km further, so is worth it at 1km per point
+	res = geo.Find(51.5, -0.1, 0, 3, "km", "release", WithScoreWeight(1))
+	if got := resultIDs(res); len(got) != 3 || got[0] != "far" || got[1] != "near" {
+		t.Errorf("Weighted results should put the 5 star record first, got %v", got)
+	}
+	if res[0].Distance < res[1].Distance {
+		t.Errorf("Weighting shouldn't change the distances returned")
+	}
+
+	// but not at 100m per point
+	res = geo.Find(51.5, -0.1, 0, 3, "km", "release", WithScoreWeight(0.1))
+	if got := resultIDs(res); len(got) != 3 || got[0] != "near" {
+		t.Errorf("Lightly weighted results should put the nearest record first, got %v", got)
+	}
+}
+
+// A Score which isn't a number should fail the import
+func TestScoreImportError(t *testing.T) {
+	var headerPos HeaderPosition
+	geo := new(GeoData)
+	geo.ImportLine(&headerPos, []string{"ID", "Title", "Description", "URL", "Bitmap", "Lat", "Lon", "Score"}, 1)
+	err := geo.ImportLine(&headerPos, []string{"1", "", "", "", "0", "51.5", "-0.1", "five"}, 2)
+	if err == nil {
+		t.Errorf("Expected an error parsing the score")
+	}
+}
+
+// Records should be filtered out by the exclude mask alone
+func TestExcludeMask(t *testing.T) {
+	geo := populateLines([][]string{
+		{"open", "", "", "", "1", "51.5", "-0.1"},
+		{"closed", "", "", "", "5", "51.5", "-0.11"},
+		{"other", "", "", "", "2", "51.5", "-0.12"},
+		{"other closed", "", "", "", "6", "51.5", "-0.13"},
+	})
+	tests := []struct {
+		bitmask, exclude uint64
+		expect           []string
+	}{
+		{0, 0, []string{"open", "closed", "other", "other closed"}},
+		{0, 4, []string{"open", "other"}},
+		{1, 4, []string{"open"}},
+		{3, 4, []string{"open", "other"}},
+		{4, 4, nil},
+		{1, 2, []string{"open", "closed"}},
+	}
+	for _, test := range tests {
+		res := geo.Find(51.5, -0.1, test.bitmask, 10, "km", "test", WithExcludeMask(test.exclude))
+		var got []string
+		for _, rec := range res {
+			got = append(got, rec.ID)
+		}
+		if !slices.Equal(got, test.expect) {
+			t.Errorf("Bitmask %d excluding %d found %v, expected %v", test.bitmask, test.exclude, got, test.expect)
+		}
+		exact := geo.FindExact(51.5, -0.1, test.bitmask, 10, "km", WithExcludeMask(test.exclude))
+		if len(exact) != len(test.expect) {
+			t.Errorf("FindExact with bitmask %d excluding %d found %d results, expected %d", test.bitmask, test.exclude, len(exact), len(test.expect))
+		}
+	}
+}
+
+// Records should need at least the threshold of the bitmask's bits
+func TestAtLeast(t *testing.T) {
+	geo := populateLines([][]string{
+		{"none", "", "", "", "8", "51.5", "-0.1"},
+		{"one", "", "", "", "9", "51.5", "-0.11"},
+		{"two", "", "", "", "3", "51.5", "-0.12"},
+		{"three", "", "", "", "7", "51.5", "-0.13"},
+		{"all", "", "", "", "15", "51.5", "-0.14"},
+	})
+	tests := []struct {
+		bitmask   uint64
+		threshold int
+		expect    []string
+	}{
+		{7, 0, []string{"one", "two", "three", "all"}},
+		{7, 1, []string{"one", "two", "three", "all"}},
+		{7, 2, []string{"two", "three", "all"}},
+		{7, 3, []string{"three", "all"}},
+		{7, 4, nil},
+		{15, 3, []string{"three", "all"}},
+		{0, 3, []string{"none", "one", "two", "three", "all"}},
+	}
+	for _, test := range tests {
+		res := geo.Find(51.5, -0.1, test.bitmask, 10, "km", "test", WithAtLeast(test.threshold))
+		var got []string
+		for _, rec := range res {
+			got = append(got, rec.ID)
+		}
+		if !slices.Equal(got, test.expect) {
+			t.Errorf("At least %d of bitmask %d found %v, expected %v", test.threshold, test.bitmask, got, test.expect)
+		}
+		if count, _ := geo.CountNear(51.5, -0.1, test.bitmask, 10, "km", WithAtLeast(test.threshold)); count != len(test.expect) {
+			t.Errorf("At least %d of bitmask %d counted %d, expected %d", test.threshold, test.bitmask, count, len(test.expect))
+		}
+	}
+
+	res := geo.Find(51.5, -0.1, 0, 10, "km", "test", WithFlagsMask(Flags{7}), WithAtLeast(2))
+	if len(res) != 3 {
+		t.Errorf("At least 2 of the flags found %v, expected 3 results", res)
+	}
+}
+
+// A cancelled search should return promptly with partial or empty results
+func TestFindCtx(t *testing.T) {
+	geo := PopulateData(51.5, -0.1, 0.001, 10000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err := geo.FindCtx(ctx, 51.5, -0.1, 0, 1000, "km", "test")
+	if !errors.Is(err, context.Canceled) || len(res) != 0 {
+		t.Errorf("Search with a cancelled context returned %d results and error %v", len(res), err)
+	}
+
+	// cancel part way through walking the curves
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	checked := 0
+	cancelling := func(bitmap uint64) bool {
+		checked++
+		if checked == 100 {
+			cancel()
+		}
+		return true
+	}
+	res, err = geo.FindCtx(ctx, 51.5, -0.1, 0, 1000, "km", "test", WithPredicate(cancelling), func(q *query) { q.sequential = true })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Search cancelled part way returned error %v", err)
+	}
+	if len(res) == 0 || len(res) >= 1000 {
+		t.Errorf("Search cancelled part way returned %d results", len(res))
+	}
+
+	res, err = geo.FindCtx(context.Background(), 51.5, -0.1, 0, 1000, "km", "test")
+	if err != nil || len(res) != 1000 {
+		t.Errorf("Search without cancelling returned %d results and error %v", len(res), err)
+	}
+}
+
+// FindStream should yield the same results as Find, in order, and
+// stop as soon as the callback returns false
+func TestFindStream(t *testing.T) {
+	geo := PopulateData(51.5, -0.1, 0.001, 1000)
+	for _, opts := range [][]FindOption{nil, {WithMerge(0.2)}} {
+		all, _ := geo.FindE(51.5, -0.1, 0, 50, "km", "test", opts...)
+		var streamed Results
+		err := geo.FindStream(51.5, -0.1, 0, 50, "km", "test", func(rec ResultRecord) bool {
+			streamed = append(streamed, rec)
+			return true
+		}, opts...)
+		if err != nil || !reflect.DeepEqual(streamed, all) {
+			t.Errorf("Streamed %d results and error %v instead of the %d found", len(streamed), err, len(all))
+		}
+
+		for _, stop := range []int{1, 5} {
+			calls := 0
+			err = geo.FindStream(51.5, -0.1, 0, 50, "km", "test", func(rec ResultRecord) bool {
+				calls++
+				if rec.ID != all[calls-1].ID {
+					t.Errorf("Streamed result %s instead of %s", rec.ID, all[calls-1].ID)
+				}
+				return calls < stop
+			}, opts...)
+			if err != nil || calls != stop {
+				t.Errorf("Streamed %d results and error %v, stopping after %d", calls, err, stop)
+			}
+		}
+	}
+
+	err := geo.FindStream(91, -0.1, 0, 50, "km", "test", func(ResultRecord) bool { return true })
+	if !errors.Is(err, ErrInvalidCoordinates) {
+		t.Errorf("Expected ErrInvalidCoordinates streaming from lat 91, got %v", err)
+	}
+}
+
+// Records sharing more of the boosted tags should outrank
+// equally near records, and slightly nearer ones when weighted
+func TestTagBoost(t *testing.T) {
+	geo := populateLines([][]string{
+		{"none", "", "", "", "4", "51.5", "-0.1"},
+		{"one", "", "", "", "1", "51.5", "-0.1"},
+		{"both", "", "", "", "3", "51.5", "-0.1"},
+		{"nearer", "", "", "", "0", "51.5", "-0.099"},
+		{"further", "", "", "", "3", "51.5", "-0.12"},
+	})
+	// equally near records are ordered by their matching tags,
+	// with only a tiny weight to break the tie
+	res := geo.Find(51.5, -0.098, 0, 5, "km", "release", WithTagBoost(0x3, 0.0001))
+	if got := resultIDs(res); !slices.Equal(got[1:4], []string{"both", "one", "none"}) {
+		t.Errorf("Equally near records should be ordered by matching tags, got %v", got)
+	}
+	if got := resultIDs(res); got[0] != "nearer" || got[4] != "further" {
+		t.Errorf("A tiny weight shouldn't outweigh distance, got %v", got)
+	}
+
+	// the nearer record is only ~70m nearer, which is outweighed at 200m per tag
+	res = geo.Find(51.5, -0.098, 0, 5, "km", "release", WithTagBoost(0x3, 0.2))
+	if got := resultIDs(res); !slices.Equal(got[:3], []string{"both", "one", "nearer"}) {
+		t.Errorf("Weighted results should put the best matches first, got %v", got)
+	}
+
+	// boosting doesn't filter, but combines with strict filtering
+	res = geo.Find(51.5, -0.098, 0, 5, "km", "release", WithTagBoost(0x3, 0.2), WithRequireMask(0x1))
+	if got := resultIDs(res); !slices.Equal(got, []string{"both", "one", "further"}) {
+		t.Errorf("Required records should still be ordered by tags and distance, got %v", got)
+	}
+}
+
+// The stats should count at least as many scanned records as returned
+func TestSearchStats(t *testing.T) {
+	geo := new(GeoData)
+	populateSpiral(geo, 0.0, 0.0, 0.0001, 1000)
+
+	var stats SearchStats
+	res := geo.Find(0, 0, 2, 20, "km", "release", WithSearchStats(&stats))
+	if stats.Results != len(res) {
+		t.Errorf("Stats reported %d results instead of %d", stats.Results, len(res))
+	}
+	if stats.Scanned < stats.Results {
+		t.Errorf("Scanned %d records but returned %d", stats.Scanned, stats.Results)
+	}
+	if len(stats.Walks) != 4 {
+		t.Fatalf("Got %d walks instead of up and down both curves", len(stats.Walks))
+	}
+	scanned := 0
+	for _, w := range stats.Walks {
+		if w.Matched > w.Scanned || w.Scanned < w.Peanos {
+			t.Errorf("Inconsistent walk stats %+v", w)
+		}
+		scanned += w.Scanned
+	}
+	if scanned != stats.Scanned {
+		t.Errorf("Walks scanned %d records in total, not %d", scanned, stats.Scanned)
+	}
+
+	// no record matches, and the few peanos are all within reach,
+	// so every peano is visited once on each curve
+	geo.Find(0, 0, 1<<63, 20, "km", "release", WithSearchStats(&stats))
+	peanos := 0
+	for _, w := range stats.Walks {
+		peanos += w.Peanos
+	}
+	if stats.Exhausted || stats.Results != 0 || peanos != len(geo.peanoMap1)+len(geo.peanoMap2) {
+		t.Errorf("Expected a search visiting every peano on each curve, got %+v", stats)
+	}
+}
+
+// Results beyond the radius should be left out
+func TestRadius(t *testing.T) {
+	geo := populateLines([][]string{
+		{"here", "", "", "", "1", "51.5", "-0.1"},
+		{"1km", "", "", "", "1", "51.509", "-0.1"},
+		{"5km", "", "", "", "1", "51.545", "-0.1"},
+	})
+	res := geo.Find(51.5, -0.1, 0, 10, "km", "release", WithRadius(2))
+	if len(res) != 2 || res[0].ID != "here" || res[1].ID != "1km" {
+		t.Errorf("Got %v within 2km", res)
+	}
+	res = geo.Find(51.5, -0.1, 0, 1, "km", "release", WithRadius(2))
+	if len(res) != 1 {
+		t.Errorf("Got %d results within 2km instead of the 1 asked for", len(res))
+	}
+	res = geo.Find(51.6, -0.1, 0, 10, "km", "release", WithRadius(1))
+	if len(res) != 0 {
+		t.Errorf("Got %v within 1km of nothing", res)
+	}
+}
+
+// Results closer than the floor should be left out, without taking the
+// place of results further away
+func TestMinDistance(t *testing.T) {
+	lines := [][]string{
+		{"1km", "", "", "", "1", "51.509", "-0.1"},
+		{"3km", "", "", "", "1", "51.527", "-0.1"},
+		{"5km", "", "", "", "1", "51.545", "-0.1"},
+	}
+	// many stores in the same building as the search location
+	for i := range 50 {
+		lines = append(lines, []string{fmt.Sprintf("same %d", i), "", "", "", "1", "51.5", "-0.1"})
+	}
+	geo := populateLines(lines)
+	res := geo.Find(51.5, -0.1, 0, 2, "km", "release", WithMinDistance(0.05))
+	if got := resultIDs(res); !slices.Equal(got, []string{"1km", "3km"}) {
+		t.Errorf("Got %v beyond 50m", got)
+	}
+	res = geo.Find(51.5, -0.1, 0, 10, "km", "release", WithMinDistance(2), WithRadius(4))
+	if got := resultIDs(res); !slices.Equal(got, []string{"3km"}) {
+		t.Errorf("Got %v from 2km to 4km", got)
+	}
+	res = geo.Find(51.5, -0.1, 0, 10, "km", "release")
+	if len(res) != 10 || res[0].Distance != 0 {
+		t.Errorf("Got %v without a floor", res)
+	}
+}
+
+// Results closer than the floor shouldn't hide the results beyond it
+// sharing their peano codes
+func TestMinDistanceSameCell(t *testing.T) {
+	geo := populateLines([][]string{
+		{"same 1", "", "", "", "1", "51.5", "-0.1"},
+		{"same 2", "", "", "", "1", "51.5", "-0.1"},
+		{"near", "", "", "", "1", "51.4985", "-0.104"},
+		{"far", "", "", "", "1", "51.6", "-0.1"},
+	})
+	if geo.calcPeano(51.4985, -0.104) != geo.calcPeano(51.5, -0.1) ||
+		geo.calcPeanoOffset(51.4985, -0.104) != geo.calcPeanoOffset(51.5, -0.1) {
+		t.Fatalf("The near record isn't in the same cells as the search location")
+	}
+	res := geo.Find(51.5, -0.1, 0, 1, "km", "release", WithMinDistance(0.02))
+	if got := resultIDs(res); !slices.Equal(got, []string{"near"}) {
+		t.Errorf("Got %v beyond 20m instead of the near record", got)
+	}
+}
+
+// The farthest candidates should come first when asked for
+func TestSortOrder(t *testing.T) {
+	var lines [][]string
+	for i := range 200 {
+		lines = append(lines, []string{fmt.Sprint(i), "", "", "", "1", fmt.Sprintf("%0.3f", 51.5+float64(i)/1000), "-0.1"})
+	}
+	geo := populateLines(lines)
+	nearest := geo.Find(51.55, -0.1, 0, 10, "km", "test")
+	res := geo.Find(51.55, -0.1, 0, 10, "km", "test", WithSortOrder(SortFarthest))
+	if len(res) != 10 {
+		t.Fatalf("Got %d results farthest first", len(res))
+	}
+	for i := 1; i < len(res); i++ {
+		if res[i].Distance > res[i-1].Distance {
+			t.Errorf("Result %d at %0.3fkm is farther than the one before at %0.3fkm", i, res[i].Distance, res[i-1].Distance)
+		}
+	}
+	if res[0].Distance <= nearest[len(nearest)-1].Distance {
+		t.Errorf("The farthest result at %0.3fkm is no farther than the nearest results", res[0].Distance)
+	}
+	if explicit := geo.Find(51.55, -0.1, 0, 10, "km", "test", WithSortOrder(SortNearest)); !reflect.DeepEqual(explicit, nearest) {
+		t.Errorf("Sorting nearest first found %v instead of %v", explicit, nearest)
+	}
+}
+
+// Tightly clustered records should merge into one result per cluster
+func TestMerge(t *testing.T) {
+	var lines [][]string
+	for c, centre := range [][2]float64{{51.5, -0.1}, {51.52, -0.1}, {51.5, -0.14}} {
+		for i := range 4 + c {
+			id := fmt.Sprintf("%d-%d", c, i)
+			lines = append(lines, []string{id, "", "", "", "1", fmt.Sprintf("%0.5f", centre[0]+float64(i)*0.0001), fmt.Sprintf("%0.4f", centre[1])})
+		}
+	}
+	geo := populateLines(lines)
+
+	res := geo.Find(51.5, -0.1, 0, 10, "km", "release", WithMerge(0.1))
+	var got []string
+	var counts []int
+	for _, rec := range res {
+		got = append(got, rec.ID)
+		counts = append(counts, rec.Count)
+	}
+	// the nearest of each cluster represents it
+	if !slices.Equal(got, []string{"0-0", "1-0", "2-0"}) || !slices.Equal(counts, []int{4, 5, 6}) {
+		t.Errorf("Got results %v with counts %v instead of one per cluster", got, counts)
+	}
+
+	res = geo.Find(51.5, -0.1, 0, 10, "km", "release")
+	if len(res) != 10 || res[0].Count != 0 {
+		t.Errorf("Got %d results, the first with count %d, without merging", len(res), res[0].Count)
+	}
+}
+
+// Shuffling with the same seed should give the same order,
+// with only records within the tolerance swapping places
+func TestShuffle(t *testing.T) {
+	var lines [][]string
+	for i := range 10 {
+		// 5 records around 1km away, then 5 around 5km
+		lat := 51.509 + float64(i%5)*0.00001
+		if i >= 5 {
+			lat = 51.545 + float64(i%5)*0.00001
+		}
+		lines = append(lines, []string{fmt.Sprint(i), "", "", "", "1", fmt.Sprintf("%0.5f", lat), "-0.1"})
+	}
+	geo := populateLines(lines)
+
+	order := func(seed uint64) []string {
+		var ids []string
+		rng := rand.New(rand.NewPCG(seed, 0))
+		for _, rec := range geo.Find(51.5, -0.1, 0, 10, "km", "release", WithShuffle(0.1, rng)) {
+			ids = append(ids, rec.ID)
+		}
+		return ids
+	}
+	first := order(1)
+	if again := order(1); !slices.Equal(first, again) {
+		t.Errorf("The same seed shuffled %v then %v", first, again)
+	}
+	shuffled := false
+	for seed := range uint64(5) {
+		got := order(seed)
+		near, far := slices.Clone(got[:5]), slices.Clone(got[5:])
+		slices.Sort(near)
+		slices.Sort(far)
+		if !slices.Equal(near, []string{"0", "1", "2", "3", "4"}) || !slices.Equal(far, []string{"5", "6", "7", "8", "9"}) {
+			t.Errorf("Shuffled records beyond the tolerance, got %v", got)
+		}
+		shuffled = shuffled || !slices.Equal(got, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"})
+	}
+	if !shuffled {
+		t.Errorf("Results were never shuffled")
+	}
+}
+
+// The peano codes should only be included when asked for
+func TestPeanos(t *testing.T) {
+	geo := populateLines([][]string{
+		{"here", "", "", "", "1", "51.5", "-0.1"},
+		{"there", "", "", "", "1", "51.6", "-0.2"},
+	})
+	for _, rec := range geo.Find(51.5, -0.1, 0, 2, "km", "release") {
+		if rec.Peano1 != nil || rec.Peano2 != nil {
+			t.Errorf("Got peano codes for %s without asking for them", rec.ID)
+		}
+	}
+
+	var codes PeanoCodes
+	res := geo.Find(51.5, -0.1, 0, 2, "km", "release", WithPeanos(&codes))
+	if codes.Peano1 != geo.calcPeano(51.5, -0.1) || codes.Peano2 != geo.calcPeanoOffset(51.5, -0.1) {
+		t.Errorf("Got search location codes %+v", codes)
+	}
+	for _, rec := range res {
+		stored, _ := geo.Record(rec.ID)
+		if rec.Peano1 == nil || rec.Peano2 == nil || *rec.Peano1 != stored.Peano1 || *rec.Peano2 != stored.Peano2 {
+			t.Errorf("Got the wrong peano codes for %s", rec.ID)
+		}
+	}
+	// the record at the search location shares its codes
+	if *res[0].Peano1 != codes.Peano1 {
+		t.Errorf("The nearest record has peano %d, the search %d", *res[0].Peano1, codes.Peano1)
+	}
+}
+
+// A far outlier should be cut off relative to a nearby cluster
+func TestRelativeCutoff(t *testing.T) {
+	geo := populateLines([][]string{
+		{"1km", "", "", "", "1", "51.509", "-0.1"},
+		{"1.5km", "", "", "", "1", "51.5135", "-0.1"},
+		{"2km", "", "", "", "1", "51.518", "-0.1"},
+		{"20km", "", "", "", "1", "51.68", "-0.1"},
+	})
+	res := geo.Find(51.5, -0.1, 0, 10, "km", "release", WithRelativeCutoff(3))
+	if got := resultIDs(res); !slices.Equal(got, []string{"1km", "1.5km", "2km"}) {
+		t.Errorf("Got %v within 3 times the nearest distance", got)
+	}
+	res = geo.Find(51.5, -0.1, 0, 10, "km", "release", WithRelativeCutoff(1.6))
+	if got := resultIDs(res); !slices.Equal(got, []string{"1km", "1.5km"}) {
+		t.Errorf("Got %v within 1.6 times the nearest distance", got)
+	}
+	if res = geo.Find(51.5, -0.1, 0, 10, "km", "release"); len(res) != 4 {
+		t.Errorf("Got %d results without a cutoff", len(res))
+	}
+
+	// a record at the search location doesn't cut off the rest
+	res = geo.Find(51.509, -0.1, 0, 10, "km", "release", WithRelativeCutoff(3))
+	if got := resultIDs(res); !slices.Equal(got, []string{"1km", "1.5km", "2km"}) {
+		t.Errorf("Got %v within 3 times the nearest distance from a record", got)
+	}
+}
+
+// An uncertain location should gather the candidates of the precise
+// location, and more from around it
+func TestAccuracy(t *testing.T) {
+	geo := PopulateData(51.5, -0.1, 0.001, 5000)
+	lat, lon := 51.52, -0.12
+	candidates := func(accuracy float64) map[string]bool {
+		q := newQuery([]FindOption{WithAccuracy(accuracy)})
+		peano1, peano2 := geo.searchPeanos(lat, lon)
+		recs, _ := runWalks(geo.searchWalks(context.Background(), lat, lon, peano1, peano2, q, 0, 20, "km"), false)
+		ids := make(map[string]bool)
+		for _, rec := range recs {
+			ids[rec.ID] = true
+		}
+		return ids
+	}
+	precise := candidates(0)
+	for _, accuracy := range []float64{0.2, 1, 5} {
+		uncertain := candidates(accuracy)
+		for id := range precise {
+			if !uncertain[id] {
+				t.Errorf("Candidate %s of the precise location is missing with an accuracy of %vkm", id, accuracy)
+			}
+		}
+		if len(uncertain) <= len(precise) {
+			t.Errorf("Got %d candidates with an accuracy of %vkm, and %d without", len(uncertain), accuracy, len(precise))
+		}
+	}
+
+	// the results are still the nearest to the location
+	res := geo.Find(lat, lon, 0, 20, "km", "test", WithAccuracy(1))
+	if len(res) != 20 || !slices.IsSortedFunc(res, func(a, b ResultRecord) int { return cmp.Compare(a.Distance, b.Distance) }) {
+		t.Errorf("Got %v with an accuracy of 1km", res)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// TestFindAlongRoute finds the records near a route of two segments,
+// ranked by their distance from the route
+func TestFindAlongRoute(t *testing.T) {
+	geo := populateLines([][]string{
+		{"bend", "", "", "", "1", "51.5005", "-0.1005"},
+		{"second", "", "", "", "1", "51.55", "-0.099"},
+		{"first", "", "", "", "1", "51.502", "-0.15"},
+		{"start", "", "", "", "2", "51.5", "-0.2"},
+		{"beyond", "", "", "", "1", "51.5", "-0.25"},
+		{"inside", "", "", "", "1", "51.55", "-0.2"},
+		{"outside", "", "", "", "1", "51.49", "-0.1"},
+	})
+	// east along 51.5, then north along -0.1
+	route := []Point{{51.5, -0.2}, {51.5, -0.1}, {51.6, -0.1}}
+	res, err := geo.FindAlongRoute(route, 0.5, 1, 10, "km")
+	if err != nil {
+		t.Fatalf("FindAlongRoute failed - %s", err)
+	}
+	// the bend is near both segments, but is only found once
+	if got := resultIDs(res); !slices.Equal(got, []string{"bend", "second", "first"}) {
+		t.Errorf("Got %v along the route", got)
+	}
+	if len(res) == 3 && (res[0].Distance != 0.035 || res[1].Distance != 0.069 || res[2].Distance != 0.222) {
+		t.Errorf("Got distances %v, %v and %v from the route", res[0].Distance, res[1].Distance, res[2].Distance)
+	}
+	res, _ = geo.FindAlongRoute(route, 2, 0, 2, "km")
+	if got := resultIDs(res); !slices.Equal(got, []string{"start", "bend"}) {
+		t.Errorf("Got %v as the 2 nearest to the route", got)
+	}
+
+	for name, args := range map[string]struct {
+		route    []Point
+		corridor float64
+	}{
+		"one point":     {route[:1], 1},
+		"zero corridor": {route, 0},
+		"invalid point": {[]Point{{91, 0}, {51.5, 0}}, 1},
+		"tiny corridor": {[]Point{{0, 0}, {50, 50}}, 0.0001},
+	} {
+		if _, err := geo.FindAlongRoute(args.route, args.corridor, 0, 10, "km"); err == nil {
+			t.Errorf("Expected an error for a route with %s", name)
+		}
+	}
+	if _, err := new(GeoData).FindAlongRoute(route, 1, 0, 10, "km"); !errors.Is(err, ErrNoData) {
+		t.Errorf("Expected ErrNoData searching no records, got %v", err)
+	}
+}
+
+// TestFindAlongRouteAntimeridian follows a route across the antimeridian
+func TestFindAlongRouteAntimeridian(t *testing.T) {
+	geo := populateLines([][]string{
+		{"west", "", "", "", "1", "-17.001", "179.9"},
+		{"east", "", "", "", "1", "-16.999", "-179.9"},
+		{"far", "", "", "", "1", "-17.5", "179.9"},
+	})
+	res, err := geo.FindAlongRoute([]Point{{-17, 179.5}, {-17, -179.5}}, 1, 0, 10, "km")
+	if err != nil {
+		t.Fatalf("FindAlongRoute failed - %s", err)
+	}
+	if len(res) != 2 || res[0].Distance > 0.2 || res[1].Distance > 0.2 {
+		t.Errorf("Got %v along the route across the antimeridian", res)
+	}
+}
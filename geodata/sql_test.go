@@ -0,0 +1,218 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testTable is a query result served by testDriver,
+// standing in for a real database without a driver dependency
+type testTable struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+// the tables of testDriver, by data source name
+var testTables = map[string]testTable{
+	"places": {
+		columns: []string{"id", "title", "description", "url", "bitmap", "latitude", "longitude", "phone"},
+		rows: [][]driver.Value{
+			{int64(1), "Cafe", nil, nil, int64(1), 51.5, -0.1, "+44 20 7946 0000"},
+			{int64(2), "Park", "Green", "https://example.com", int64(2), 51.6, -0.2, nil},
+			{"three", "Pub", "", "", "3", "51.7", "-0.3", ""},
+		},
+	},
+	"bad": {
+		columns: []string{"id", "title", "description", "url", "bitmap", "latitude", "longitude"},
+		rows: [][]driver.Value{
+			{int64(1), "Nowhere", nil, nil, int64(1), 95.0, 0.0},
+		},
+	},
+}
+
+// the number of rows in each batch fetched from a cursor
+var testFetches []int
+
+type testDriver struct{}
+type testConn struct {
+	table testTable
+	// the position of the cursor, like PostgreSQL's FETCH
+	cursor int
+}
+type testStmt struct {
+	conn  *testConn
+	query string
+}
+type testRows struct {
+	table testTable
+	next  int
+}
+
+func init() {
+	sql.Register("proximitytest", testDriver{})
+}
+
+func (testDriver) Open(name string) (driver.Conn, error) {
+	table, found := testTables[name]
+	if !found {
+		return nil, errors.New("No such table")
+	}
+	return &testConn{table: table}, nil
+}
+
+func (conn *testConn) Prepare(query string) (driver.Stmt, error) { return &testStmt{conn, query}, nil }
+func (conn *testConn) Close() error                              { return nil }
+func (conn *testConn) Begin() (driver.Tx, error)                 { return conn, nil }
+func (conn *testConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return conn, nil
+}
+func (conn *testConn) Commit() error   { return nil }
+func (conn *testConn) Rollback() error { return nil }
+
+func (stmt *testStmt) Close() error  { return nil }
+func (stmt *testStmt) NumInput() int { return -1 }
+func (stmt *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if !strings.HasPrefix(stmt.query, "DECLARE ") {
+		return nil, errors.New("Read only")
+	}
+	stmt.conn.cursor = 0
+	return driver.ResultNoRows, nil
+}
+func (stmt *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	table := stmt.conn.table
+	var size int
+	if _, err := fmt.Sscanf(stmt.query, "FETCH FORWARD %d FROM", &size); err == nil {
+		start := stmt.conn.cursor
+		stmt.conn.cursor = min(start+size, len(table.rows))
+		table.rows = table.rows[start:stmt.conn.cursor]
+		testFetches = append(testFetches, len(table.rows))
+	}
+	return &testRows{table: table}, nil
+}
+
+func (rows *testRows) Columns() []string { return rows.table.columns }
+func (rows *testRows) Close() error      { return nil }
+func (rows *testRows) Next(dest []driver.Value) error {
+	if rows.next == len(rows.table.rows) {
+		return io.EOF
+	}
+	copy(dest, rows.table.rows[rows.next])
+	rows.next++
+	return nil
+}
+
+// TestImportSQL imports typed rows and NULLs from a database,
+// mapping the differently named coordinate columns
+func TestImportSQL(t *testing.T) {
+	geo, err := NewGeoData(WithColumnNames(map[string]string{"latitude": "Lat", "longitude": "Lon"}))
+	if err != nil {
+		t.Fatalf("Failed to create GeoData: %s", err)
+	}
+	db, err := sql.Open("proximitytest", "places")
+	if err != nil {
+		t.Fatalf("Failed to open the test database: %s", err)
+	}
+	defer db.Close()
+	if err := geo.ImportSQL(db, "SELECT * FROM places", "test"); err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+
+	res := geo.Find(51.5, -0.1, 0, 3, "km", "test")
+	if len(res) != 3 {
+		t.Fatalf("Got %d results instead of 3", len(res))
+	}
+	if res[0].ID != "1" || res[0].Title != "Cafe" || res[0].Description != "" || res[0].Meta["phone"] != "+44 20 7946 0000" {
+		t.Errorf("Got %+v for the first row", res[0])
+	}
+	if res[1].URL != "https://example.com" || res[1].Bitmap != 2 || res[1].Lat != 51.6 || res[1].Meta != nil {
+		t.Errorf("Got %+v for the second row", res[1])
+	}
+	if res[2].ID != "three" || res[2].Bitmap != 3 || res[2].Lon != -0.3 {
+		t.Errorf("Got %+v for the third row", res[2])
+	}
+
+	// without the mapping, the coordinate columns are missing
+	err = new(GeoData).ImportSQL(db, "SELECT * FROM places", "test")
+	if err == nil || !strings.Contains(err.Error(), "'Lat'") {
+		t.Errorf("Expected an error for the missing Lat column, got %v", err)
+	}
+}
+
+// TestImportSQLite opens the database with the SQLiteDriver,
+// and fails rows with the same validation as a CSV import
+func TestImportSQLite(t *testing.T) {
+	defer func(driver string) { SQLiteDriver = driver }(SQLiteDriver)
+	SQLiteDriver = "proximitytest"
+
+	geo, _ := NewGeoData(WithColumnNames(map[string]string{"latitude": "Lat", "longitude": "Lon"}))
+	if err := geo.ImportSQLite("places", "SELECT * FROM places", "test"); err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	if len(geo.records) != 3 {
+		t.Errorf("Imported %d records instead of 3", len(geo.records))
+	}
+
+	geo, _ = NewGeoData(WithColumnNames(map[string]string{"latitude": "Lat", "longitude": "Lon"}))
+	err := geo.ImportSQLite("bad", "SELECT * FROM bad", "test")
+	if err == nil || !strings.Contains(err.Error(), "outside range") {
+		t.Errorf("Expected an error importing an invalid latitude, got %v", err)
+	}
+}
+
+// TestImportPostgresCursor fetches the rows through
+// the cursor in batches, with the test driver
+func TestImportPostgresCursor(t *testing.T) {
+	defer func(driver string, rows int) {
+		PostgresDriver, PostgresFetchRows = driver, rows
+	}(PostgresDriver, PostgresFetchRows)
+	PostgresDriver, PostgresFetchRows = "proximitytest", 2
+	testFetches = nil
+
+	geo, _ := NewGeoData(WithColumnNames(map[string]string{"latitude": "Lat", "longitude": "Lon"}))
+	if err := geo.ImportPostgres("places", "SELECT * FROM places", "test"); err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	if len(geo.records) != 3 || geo.records[2].ID != "three" {
+		t.Errorf("Imported %d records, expected all 3 in order", len(geo.records))
+	}
+	if !slices.Equal(testFetches, []int{2, 1}) {
+		t.Errorf("Fetched batches of %v rows, expected 2 then the last 1", testFetches)
+	}
+}
+
+// TestImportPostgres imports from a real PostgreSQL database, only when
+// PROXIMITY_TEST_POSTGRES is set to its dsn, and the PostgresDriver is
+// registered.  No driver is linked in by default, so it needs a test
+// file behind a build tag, e.g. //go:build postgres, importing one for
+// its side effects, and go test -tags postgres.
+func TestImportPostgres(t *testing.T) {
+	dsn := os.Getenv("PROXIMITY_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("Set PROXIMITY_TEST_POSTGRES to a dsn to test importing from PostgreSQL")
+	}
+	if !slices.Contains(sql.Drivers(), PostgresDriver) {
+		t.Skipf("The %s driver isn't registered - link one in with a build-tagged test file importing it, e.g. //go:build postgres", PostgresDriver)
+	}
+	query := "SELECT 'pg' || n AS id, '' AS title, '' AS description, '' AS url, 1 AS bitmap, " +
+		"51.5 + n * 0.001 AS lat, -0.1 AS lon FROM generate_series(1, 25) AS n"
+	geo := new(GeoData)
+	if err := geo.ImportPostgres(dsn, query, "test"); err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	if res := geo.Find(51.5, -0.1, 0, 30, "km", "test"); len(res) != 25 || res[0].ID != "pg1" {
+		t.Errorf("Got %d results imported from PostgreSQL", len(res))
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestStatsCache checks the stats are cached until the indexes are repopulated
+func TestStatsCache(t *testing.T) {
+	geo := PopulateData(0.0, 0.0, 0.0001, 100)
+	stats := geo.Stats()
+	if stats.RecordCount != 100 {
+		t.Errorf("Got a record count of %d instead of 100", stats.RecordCount)
+	}
+
+	// sneak in another record without repopulating the indexes
+	geo.records = append(geo.records, Record{ID: "extra", Lat: 10, Lon: 10})
+	if stats := geo.Stats(); stats.RecordCount != 100 {
+		t.Errorf("Stats weren't cached, got a record count of %d", stats.RecordCount)
+	}
+
+	geo.PopulateIndexes("test")
+	stats = geo.Stats()
+	if stats.RecordCount != 101 || stats.MaxLat != 10 || stats.MaxLon != 10 {
+		t.Errorf("Stats weren't recalculated after repopulating the indexes: %+v", stats)
+	}
+}
+
+// TestBounds checks the bounds cover all the records,
+// and follow a reload
+func TestBounds(t *testing.T) {
+	geo := populateLines([][]string{
+		{"1", "", "", "", "0", "51.5", "-0.1"},
+		{"2", "", "", "", "0", "-33.9", "151.2"},
+		{"3", "", "", "", "0", "40.7", "-74.0"},
+	})
+	expect := Bounds{MinLat: -33.9, MaxLat: 51.5, MinLon: -74.0, MaxLon: 151.2}
+	if got := geo.Bounds(); got != expect {
+		t.Errorf("Got bounds %+v instead of %+v", got, expect)
+	}
+
+	csv := "ID,Title,Description,URL,Bitmap,Lat,Lon\n1,,,,0,10,20\n2,,,,0,11,21\n"
+	if _, err := geo.SyncReader(strings.NewReader(csv), "test"); err != nil {
+		t.Fatalf("Reload failed: %s", err)
+	}
+	expect = Bounds{MinLat: 10, MaxLat: 11, MinLon: 20, MaxLon: 21}
+	if got := geo.Bounds(); got != expect {
+		t.Errorf("Got bounds %+v after a reload instead of %+v", got, expect)
+	}
+
+	if got := new(GeoData).Bounds(); got != (Bounds{}) {
+		t.Errorf("Got bounds %+v without any records", got)
+	}
+}
+
+// TestClusterWarning feeds in many records at the same location,
+// which should log a warning
+func TestClusterWarning(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	lines := [][]string{}
+	for i := range 200 {
+		lat, lon := "51.507222", "-0.1275"
+		// a quarter of the records at a centroid
+		if i%4 != 0 {
+			lat, lon = fmt.Sprintf("%0.2f", float64(i)/10), fmt.Sprintf("%0.2f", float64(i)/10)
+		}
+		lines = append(lines, []string{fmt.Sprintf("%d", i), "", "", "", "0", lat, lon})
+	}
+	populateLines(lines)
+	if !strings.Contains(buf.String(), "Warning: 50 of 200 records share a single peano code") {
+		t.Errorf("No clustering warning logged, got: %s", buf.String())
+	}
+
+	// the spiral has no big clusters
+	buf.Reset()
+	geo, _ := NewGeoData(WithClusterWarning(0.5), WithLogLevel(LogQuiet))
+	populateSpiral(geo, 0.0, 0.0, 0.01, 200)
+	if buf.Len() > 0 {
+		t.Errorf("Unexpected clustering warning: %s", buf.String())
+	}
+}
+
+// TestDistanceHistogram counts each result in the bucket of its distance
+func TestDistanceHistogram(t *testing.T) {
+	geo := PopulateData(51.5, -0.1, 0.001, 500)
+	hist := DistanceHistogram{Bounds: []float64{0.5, 1, 2}}
+	res := geo.Find(51.5, -0.1, 0, 50, "km", "test", WithDistanceHistogram(&hist))
+	if len(hist.Counts) != 4 {
+		t.Fatalf("Got %d counts for %d bounds", len(hist.Counts), len(hist.Bounds))
+	}
+	total := 0
+	for _, count := range hist.Counts {
+		total += count
+	}
+	if total != len(res) {
+		t.Errorf("The histogram %v counts %d results instead of %d", hist.Counts, total, len(res))
+	}
+	for _, rec := range res {
+		if rec.Distance <= 0.5 {
+			hist.Counts[0]--
+		}
+	}
+	if hist.Counts[0] != 0 {
+		t.Errorf("The first bucket is %d off the results within 0.5km", hist.Counts[0])
+	}
+
+	// a distance on a bound counts in the bucket it bounds
+	hist.record(Results{{Distance: 0.5}, {Distance: 1.5}, {Distance: 3}, {Distance: 3}})
+	if !slices.Equal(hist.Counts, []int{1, 0, 1, 2}) {
+		t.Errorf("Got counts %v", hist.Counts)
+	}
+}
+
+// TestBucketSkew reports the 99th percentile of a few large buckets
+// among many single record ones
+func TestBucketSkew(t *testing.T) {
+	var lines [][]string
+	for i := range 100 {
+		lines = append(lines, []string{fmt.Sprint(i), "", "", "", "1", fmt.Sprintf("%0.2f", 40+float64(i)/10), "-0.1"})
+	}
+	// 5 clusters of 20 records sharing a location
+	for c := range 5 {
+		for i := range 20 {
+			lines = append(lines, []string{fmt.Sprintf("c%d-%d", c, i), "", "", "", "1", "10", fmt.Sprint(c * 10)})
+		}
+	}
+	geo := populateLines(lines)
+	curve1, curve2 := geo.BucketSkew()
+	// 105 buckets, so the 99th percentile is the 104th smallest
+	expected := BucketStats{Max: 20, Mean: 200.0 / 105, P99: 20}
+	if curve1 != expected || curve2 != expected {
+		t.Errorf("Got bucket stats %+v and %+v instead of %+v", curve1, curve2, expected)
+	}
+	if stats := geo.Stats(); stats.Buckets1 != expected {
+		t.Errorf("Got stats of buckets %+v instead of %+v", stats.Buckets1, expected)
+	}
+
+	even := PopulateData(51.5, -0.1, 0.01, 100)
+	if curve1, _ := even.BucketSkew(); curve1 != (BucketStats{Max: 1, Mean: 1, P99: 1}) {
+		t.Errorf("Got bucket stats %+v of evenly spread records", curve1)
+	}
+	if curve1, _ := new(GeoData).BucketSkew(); curve1 != (BucketStats{}) {
+		t.Errorf("Got bucket stats %+v without any records", curve1)
+	}
+}
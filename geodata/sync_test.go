@@ -0,0 +1,59 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestSync adds a record, moves one, removes one, and leaves one alone
+func TestSync(t *testing.T) {
+	geo := new(GeoData)
+	err := geo.ImportReader(strings.NewReader("ID,Title,Description,URL,Bitmap,Lat,Lon\n"+
+		"stays,,,,1,51.5,-0.1\n"+
+		"moves,,,,1,51.5,-0.11\n"+
+		"goes,,,,1,51.5,-0.12\n"), "test")
+	if err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sync.csv")
+	os.WriteFile(path, []byte("ID,Title,Description,URL,Bitmap,Lat,Lon\n"+
+		"new,,,,1,51.5,-0.13\n"+
+		"moves,,,,1,55.9,-3.2\n"+
+		"stays,,,,1,51.5,-0.1\n"), 0644)
+	stats, err := geo.Sync(path, "test")
+	if err != nil {
+		t.Fatalf("Sync failed: %s", err)
+	}
+	if stats != (SyncStats{Added: 1, Updated: 1, Removed: 1, Unchanged: 1}) {
+		t.Errorf("Got sync stats %+v", stats)
+	}
+	mustValidate(geo)
+
+	res := geo.Find(51.5, -0.1, 0, 10, "km", "test")
+	if got := resultIDs(res); !slices.Equal(got, []string{"stays", "new", "moves"}) {
+		t.Errorf("Got results %v after syncing", got)
+	}
+	if moved := geo.Find(55.9, -3.2, 0, 1, "km", "test"); len(moved) != 1 || moved[0].ID != "moves" || moved[0].Distance > 0.001 {
+		t.Errorf("The moved record wasn't found at its new location, got %v", moved)
+	}
+
+	// a bad line leaves the records alone
+	os.WriteFile(path, []byte("ID,Title,Description,URL,Bitmap,Lat,Lon\n"+
+		"stays,,,,1,51.5,-0.1\n"+
+		"bad,,,,1,north,-0.1\n"), 0644)
+	if _, err := geo.Sync(path, "test"); err == nil {
+		t.Errorf("No error syncing a bad line")
+	}
+	if res := geo.Find(51.5, -0.1, 0, 10, "km", "test"); len(res) != 3 {
+		t.Errorf("A failed sync changed the records, got %v", resultIDs(res))
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright Philip Abrahamson 2025-2026
+// Copyright High Country Software Ltd 2002-2004
+//
+// Licensed under the GNU General Public License version 2.0 (GPLv2)
+
+package geodata
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"testing"
+)
+
+// The parallel walks should find exactly the same results, and go as
+// far along the curves, as the walks one after another
+func TestParallelWalks(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	geo := populateClustered(rng, 20000, 49.0, 59.0, -8.0, 2.0)
+	sequential := func(q *query) { q.sequential = true }
+	for i := range 20 {
+		lat, lon := 49.0+rng.Float64()*10, -8.0+rng.Float64()*10
+		// every other search filtered, skipping about half the records
+		bitmask := uint64(i % 2)
+		var wantStats, gotStats SearchStats
+		want := geo.Find(lat, lon, bitmask, 500, "km", "test", sequential, WithSearchStats(&wantStats))
+		got := geo.Find(lat, lon, bitmask, 500, "km", "test", WithSearchStats(&gotStats))
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("Parallel walks at %0.4f, %0.4f found different results", lat, lon)
+		}
+		if !reflect.DeepEqual(wantStats, gotStats) {
+			t.Errorf("Parallel walks at %0.4f, %0.4f went %+v instead of %+v", lat, lon, gotStats, wantStats)
+		}
+	}
+}
+
+// BenchmarkLargeMax compares the latency of a single query for many
+// results, walking the curves one after another and in parallel
+func BenchmarkLargeMax(b *testing.B) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	geo := populateClustered(rng, 200000, 49.0, 59.0, -8.0, 2.0)
+	for _, bench := range []struct {
+		name string
+		opts []FindOption
+	}{
+		{"sequential", []FindOption{func(q *query) { q.sequential = true }}},
+		{"parallel", nil},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for b.Loop() {
+				geo.Find(51.5, -0.1, 0, 5000, "km", "release", bench.opts...)
+			}
+		})
+	}
+}
+
+// BenchmarkSingleCurve compares the latency of walking both curves with
+// walking only the primary curve
+func BenchmarkSingleCurve(b *testing.B) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	geo := populateClustered(rng, 200000, 49.0, 59.0, -8.0, 2.0)
+	for _, bench := range []struct {
+		name string
+		opts []FindOption
+	}{
+		{"both", nil},
+		{"single", []FindOption{WithSingleCurve()}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for b.Loop() {
+				geo.Find(51.5, -0.1, 0, 20, "km", "release", bench.opts...)
+			}
+		})
+	}
+}
+
+// BenchmarkPeanoLayout compares the latency of queries over records in
+// the order they were imported with records in primary peano order,
+// which are read with fewer cache misses
+func BenchmarkPeanoLayout(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		opts []Option
+	}{
+		{"imported", nil},
+		{"peano", []Option{WithPeanoLayout()}},
+	} {
+		geo := populateClustered(rand.New(rand.NewPCG(1, 2)), 500000, 49.0, 59.0, -8.0, 2.0, bench.opts...)
+		rng := rand.New(rand.NewPCG(3, 4))
+		b.Run(bench.name, func(b *testing.B) {
+			for b.Loop() {
+				geo.Find(49+rng.Float64()*10, -8+rng.Float64()*10, 0, 200, "km", "release")
+			}
+		})
+	}
+}
+
+// BenchmarkFindAllocs measures the memory churned by a query for many
+// results, which gathers far more candidates than it returns
+func BenchmarkFindAllocs(b *testing.B) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	geo := populateClustered(rng, 50000, 49.0, 59.0, -8.0, 2.0)
+	b.ReportAllocs()
+	for b.Loop() {
+		geo.Find(51.5, -0.1, 0, 50, "km", "release")
+	}
+}
+
+// The candidates gathered along the curves should never exceed the cap
+func TestMaxCandidates(t *testing.T) {
+	geo, err := NewGeoData(WithMaxCandidates(40))
+	if err != nil {
+		t.Fatalf("Failed to create a GeoData - %s", err)
+	}
+	populateSpiral(geo, 51.5, -0.1, 0.0001, 10000)
+
+	for _, max := range []uint64{5, 100, 1000} {
+		var stats SearchStats
+		res := geo.Find(51.5, -0.1, 0, max, "km", "release", WithSearchStats(&stats))
+		matched := 0
+		for _, w := range stats.Walks {
+			matched += w.Matched
+		}
+		if matched > 40 {
+			t.Errorf("Gathered %d candidates for %d results, more than the cap of 40", matched, max)
+		}
+		// 5 results per walk is within the cap of 10 per walk
+		if max == 5 && len(res) != 5 {
+			t.Errorf("Got %d results instead of 5 within the cap", len(res))
+		}
+	}
+}
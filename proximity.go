@@ -54,7 +54,7 @@
 //	  "bitmap": 2,
 //	  "lat": 51.123456,
 //	  "lon": -1.123456,
-//	  "distance": 13.72768992,
+//	  "distance": 13.728,
 //	  "units": "km"
 //	},
 //	{
@@ -65,25 +65,35 @@
 //	  "bitmap": 3,
 //	  "lat": 52.123456,
 //	  "lon": -1.123456,
-//	  "distance": 112.03917839550444,
+//	  "distance": 112.039,
 //	  "units": "km"
 //	},
 //	...
 //
 // ]
 //
-// BTW Don't be fooled by the distance field's number of decimal places.
+// BTW Don't be fooled by the distance field's number of decimal places (3 by
+// default, see DISTANCE_DECIMALS).
 // It's probably no more accurate than one or maybe two decimal places,
 // and is "as the drone or crow flies" instead of distance by windy road.
 package main
 
 import (
+	// most handlers name their *gin.Context "context"
+	stdcontext "context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"reflect"
 	"runtime"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aviddiviner/gin-limit"
 	"github.com/gin-gonic/gin"
@@ -94,20 +104,77 @@ const DefaultDataFile = "proximity.csv"
 const DefaultPort = 8080
 const DefaultMaxResults = 20
 const LimitMaxResults = 100
+
+// By default, cap the candidates of a search at what the four walks
+// along the curves gather for the LimitMaxResults
+const DefaultMaxCandidates = 4 * LimitMaxResults
 const FloatSize = 64
 const BitmaskSize = 64
 const MaxResultsSize = 64
 
 // Job defines each queued search which will be run by the worker pool
 type Job struct {
+	// Ctx is cancelled if the client goes away
+	Ctx     stdcontext.Context
 	Lat     float64
 	Lon     float64
 	Bitmask uint64
-	Results chan<- geodata.Results
+	Units   geodata.Units
+	Max     uint64
+	Require uint64
+	Exclude uint64
+	// AtLeast is how many of the Bitmask's bits a result must
+	// have, or 0 for any of them
+	AtLeast int
+	// Predicate replaces the Bitmask when an expression was sent
+	Predicate geodata.Predicate
+	Distance  geodata.DistanceMode
+	// Flags replaces the Bitmask when it's wider than 64 bits
+	Flags geodata.Flags
+	// ExcludeFlags replaces Exclude when it's wider than 64 bits
+	ExcludeFlags geodata.Flags
+	// Radius is the optional distance cutoff, or 0 for none
+	Radius float64
+	// MinDistance is the optional distance floor, or 0 for none
+	MinDistance float64
+	// Merge is the optional distance to merge results within, or 0
+	Merge float64
+	// Accuracy is the optional uncertainty of the location, or 0
+	Accuracy float64
+	// Stats is filled in if set, for the debug search endpoint
+	Stats *geodata.SearchStats
+	// Histogram counts the result distances if set, for the debug
+	// search endpoint
+	Histogram *geodata.DistanceHistogram
+	// Peanos is filled in with the search location's codes if set,
+	// and each result then includes its own codes
+	Peanos *geodata.PeanoCodes
+	// Bearings includes each result's compass bearing if set
+	Bearings bool
+	// Fields are the result fields to respond with, or nil for all
+	Fields []string
+	// Format is how to respond with the results, "json" or "ndjson"
+	Format string
+	// Envelope nests the results alongside a description of the search
+	Envelope bool
+	// Curve is the curve to list, for the debug curve endpoint
+	Curve   int
+	Results chan<- JobResult
+}
+
+// JobResult is the outcome of a Job, posted back by the worker
+type JobResult struct {
+	Results geodata.Results
+	Err     error
 }
 
 func main() {
 
+	// "proximity query ..." runs a single search, without the server
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		os.Exit(runQuery(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	router := setupRouter()
 
 	// Start server on the port specified by the PORT environment variable (8080 by default)
@@ -124,56 +191,342 @@ func setupRouter() *gin.Engine {
 	gin.SetMode(mode)
 	log.Printf("Proximity is in %s mode\n", mode)
 
-	// generate the proximity data & indices from a CSV file
-	log.Print("Importing data...")
-	geo := new(geodata.GeoData)
-	err := geo.Import(datafile(), mode)
+	level, err := geodata.ParseLogLevel(os.Getenv("LOG_LEVEL"))
 	if err != nil {
 		panic(err)
 	}
-
-	// initialise the proximity engine worker pool
-	jobs, size := initPool(geo, mode)
+	timeout := jobTimeout()
 
 	// Gin router with default middleware (logger and recovery)
 	router := gin.Default()
-	router.SetTrustedProxies(nil)
+	// client IPs are only taken from the headers of TRUSTED_PROXIES
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		panic(err)
+	}
+
+	// allow cross-origin requests from the CORS_ORIGINS
+	router.Use(cors(corsOrigins()))
+
+	// require the API_KEY, if one is set
+	router.Use(apiKeyAuth(os.Getenv("API_KEY")))
+
+	// limit each client's request rate to RATE_LIMIT per second,
+	// before they can take up one of the simultaneous requests below
+	router.Use(rateLimitClients(rateLimit()))
+
+	// gzip large responses, if GZIP is set
+	router.Use(gzipResponses(compression()))
+
+	// a description of the search parameters, for client developers
+	router.GET("/schema", func(context *gin.Context) {
+		respond(context, mode, gin.H{"parameters": querySchema()})
+	})
+
+	datasetFiles := datasets()
+	if len(datasetFiles) == 0 {
+		// a single dataset from the DATAFILE, searched at the root
+		geo := loadData(datafile(), level, mode)
+		serveData(router.Group("/"), "/", geo, mode, timeout)
+	}
+	// or several independent DATASETS, each searched at /{dataset}/search
+	for name, file := range datasetFiles {
+		log.Printf("Dataset %s:", name)
+		geo := loadData(file, level, mode)
+		serveData(router.Group("/"+name), "/search", geo, mode, timeout)
+	}
+
+	// profiling, only in debug mode
+	if mode == "debug" {
+		pprofRoutes(router)
+	}
+
+	return router
+}
+
+// loadData imports the geospatial data & indices from a CSV file or URL,
+// along with the FLAGSFILE naming its bitmap flags, panicking if they
+// can't be imported, as the server is no use without them
+func loadData(file string, level geodata.LogLevel, mode string) *geodata.GeoData {
+	geo, err := importData(file, level, mode)
+	if err != nil {
+		panic(err)
+	}
+	return geo
+}
+
+// importData is loadData, returning any error importing the data
+func importData(file string, level geodata.LogLevel, mode string) (*geodata.GeoData, error) {
+	log.Print("Importing data...")
+	opts := []geodata.Option{
+		geodata.WithUnits(units()),
+		geodata.WithLogLevel(level),
+		geodata.WithSearchWidth(searchWidth()),
+		geodata.WithMaxCandidates(maxCandidates()),
+		geodata.WithDistanceDecimals(distanceDecimals()),
+		geodata.WithIDStrategy(idStrategy()),
+	}
+	if format := coordinateFormat(); format != geodata.CoordinateDecimal {
+		opts = append(opts, geodata.WithCoordinateFormats(format, format))
+	}
+	if places, set := snapDecimals(); set {
+		opts = append(opts, geodata.WithSnapDecimals(places))
+	}
+	if minLat, maxLat, set := latitudeBand(); set {
+		opts = append(opts, geodata.WithLatitudeBand(minLat, maxLat))
+	}
+	if base := bitmapBase(); base != 0 {
+		opts = append(opts, geodata.WithBitmapBase(base))
+	}
+	if dir := indexCache(); dir != "" {
+		opts = append(opts, geodata.WithIndexCache(dir))
+	}
+	geo, err := geodata.NewGeoData(opts...)
+	if err != nil {
+		return nil, err
+	}
+	// the file can also be fetched from a URL, e.g. in object storage
+	if strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://") {
+		err = geo.ImportURL(file, mode)
+	} else {
+		err = geo.Import(file, mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if flags := flagsfile(); flags != "" {
+		if err := geo.ImportFlags(flags); err != nil {
+			return nil, err
+		}
+	}
+	return geo, nil
+}
+
+// serveData sets up the search and statistics endpoints of a dataset
+// on the router group, with its own pool of proximity workers, so that
+// a busy dataset can't hold up searches of any other
+func serveData(group *gin.RouterGroup, searchPath string, geo *geodata.GeoData, mode string, timeout time.Duration) {
+	// initialise the proximity engine worker pool
+	jobs, size := initPool(geo, mode)
 
-	router.Use(attachData(geo))
+	group.Use(attachData(geo))
 
 	// limit the maximum number of simultaneous API requests
 	// to that of the proximity engine pool size
-	router.Use(limit.MaxAllowed(size))
+	group.Use(limit.MaxAllowed(size))
 
 	// Proximity search endpoint
-	router.GET("/", func(context *gin.Context) {
+	group.GET(searchPath, searchHandler(jobs, mode, timeout, false))
+
+	// the same search with SearchStats, for tuning, only in debug mode
+	if mode == "debug" {
+		group.GET("/debug/search", searchHandler(jobs, mode, timeout, true))
+		// the path of each curve through the records, for plotting
+		group.GET("/debug/curve", curveHandler(geo, mode))
+	}
+
+	// A single record by its ID, e.g. for a detail page
+	group.GET("/record/:id", func(context *gin.Context) {
+		rec, found := geo.Record(context.Param("id"))
+		if !found {
+			context.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No record has the ID '%s'", context.Param("id"))})
+			return
+		}
+		respond(context, mode, rec)
+	})
+
+	// The number of matching records within a radius, e.g. for a heatmap
+	group.GET("/count", countHandler(geo, mode))
 
-		lat, lon, bitmask, err := parseParams(context, mode)
+	// Statistics about the data and its indexes, for debugging data quality
+	group.GET("/stats", func(context *gin.Context) {
+		respond(context, mode, geo.Stats())
+	})
+
+	// The bounding box of the data, e.g. for a map to center on
+	group.GET("/bounds", func(context *gin.Context) {
+		respond(context, mode, geo.Bounds())
+	})
+}
+
+// countHandler responds with the number of records matching the search
+// parameters within the radius, which is required, as a "count"
+func countHandler(geo *geodata.GeoData, mode string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		job, err := parseParams(context, mode, endpointCount)
+		if err == nil && job.Radius == 0 {
+			err = fmt.Errorf("A radius is required to count records")
+		}
 		if err != nil {
 			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		opts := []geodata.FindOption{
+			geodata.WithRequireMask(job.Require),
+			geodata.WithExcludeMask(job.Exclude),
+			geodata.WithAtLeast(job.AtLeast),
+			geodata.WithDistanceMode(job.Distance),
+		}
+		if job.Predicate != nil {
+			opts = append(opts, geodata.WithPredicate(job.Predicate))
+		}
+		if job.Flags != nil {
+			opts = append(opts, geodata.WithFlagsMask(job.Flags))
+		}
+		if job.ExcludeFlags != nil {
+			opts = append(opts, geodata.WithExcludeFlags(job.ExcludeFlags))
+		}
+		count, err := geo.CountNear(job.Lat, job.Lon, job.Bitmask, job.Radius, job.Units, opts...)
+		switch {
+		case errors.Is(err, geodata.ErrInvalidCoordinates):
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, geodata.ErrNoData):
+			context.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		respond(context, mode, gin.H{"count": count})
+	}
+}
 
-		// create a channel to receive the proximity search result
-		res := make(chan geodata.Results)
+// curveHandler responds with the peano codes along curve 1 (the
+// default) or 2 in order, with their coordinates and record IDs
+func curveHandler(geo *geodata.GeoData, mode string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		job, err := parseParams(context, mode, endpointDebugCurve)
+		if err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		points, err := geo.CurveOrder(job.Curve)
+		if err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respond(context, mode, points)
+	}
+}
+
+// searchHandler posts each proximity search to the pool of jobs and
+// responds with the results, along with how much of the curves the
+// search examined if withStats
+func searchHandler(jobs chan<- Job, mode string, timeout time.Duration, withStats bool) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		endpoint := endpointSearch
+		if withStats {
+			endpoint = endpointDebugSearch
+		}
+		job, err := parseParams(context, mode, endpoint)
+		if err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		fields, format, envelope := job.Fields, job.Format, job.Envelope
+		start := time.Now()
+
+		// create a channel to receive the proximity search result,
+		// buffered so a worker finishing after a timeout doesn't block
+		res := make(chan JobResult, 1)
+
+		// the search is abandoned if the client goes away, or it times out
+		ctx := context.Request.Context()
+		if timeout > 0 {
+			var cancel stdcontext.CancelFunc
+			ctx, cancel = stdcontext.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		if withStats {
+			job.Stats = new(geodata.SearchStats)
+		}
 
 		// post this proximity search as a job for the pool of workers to pick up
-		job := Job{Lat: lat, Lon: lon, Bitmask: bitmask, Results: res}
+		job.Ctx = ctx
+		job.Results = res
 		postJob(jobs, job)
 
-		// block until we get the results
-		results := <-res
+		// block until we get the results, or give up
+		var result JobResult
+		select {
+		case result = <-res:
+		case <-ctx.Done():
+			result = JobResult{Err: ctx.Err()}
+		}
+		results := result.Results
+
+		switch {
+		case errors.Is(result.Err, stdcontext.DeadlineExceeded):
+			context.JSON(http.StatusGatewayTimeout, gin.H{"error": "The search timed out"})
+			return
+		case errors.Is(result.Err, stdcontext.Canceled):
+			// the client went away, so there's nobody to respond to
+			return
+		case errors.Is(result.Err, geodata.ErrInvalidCoordinates):
+			context.JSON(http.StatusBadRequest, gin.H{"error": result.Err.Error()})
+			return
+		case errors.Is(result.Err, geodata.ErrNoData):
+			context.JSON(http.StatusServiceUnavailable, gin.H{"error": result.Err.Error()})
+			return
+		}
+		// partial results (geodata.ErrPartialResults) are still results
+
+		// tell apart "nothing within the radius" from any other empty response
+		if job.Radius > 0 && len(results) == 0 {
+			context.Header("X-Proximity-Exhausted", "radius")
+			results = geodata.Results{}
+		}
 
 		if mode != "release" {
-			context.IndentedJSON(http.StatusOK, results)
 			log.Print("Results:")
 			log.Print(results)
-		} else {
-			context.JSON(http.StatusOK, results)
 		}
-	})
 
-	return router
+		if withStats || envelope {
+			body := any(results)
+			if fields != nil {
+				body = project(results, fields)
+			}
+			wrapped := gin.H{"results": body}
+			if withStats {
+				wrapped["stats"] = job.Stats
+			}
+			if job.Histogram != nil {
+				wrapped["histogram"] = job.Histogram
+			}
+			if envelope {
+				meta := gin.H{
+					"query": gin.H{
+						"lat":     job.Lat,
+						"lon":     job.Lon,
+						"bitmask": job.Bitmask,
+						"units":   job.Units,
+						"max":     job.Max,
+					},
+					"count":   len(results),
+					"partial": errors.Is(result.Err, geodata.ErrPartialResults),
+					"took_ms": float64(time.Since(start).Microseconds()) / 1000,
+				}
+				if job.Peanos != nil {
+					meta["peanos"] = job.Peanos
+				}
+				// note that the candidates were gathered around an uncertain location
+				if job.Accuracy > 0 {
+					meta["accuracy"] = job.Accuracy
+				}
+				wrapped["meta"] = meta
+			}
+			respond(context, mode, wrapped)
+			return
+		}
+
+		switch {
+		case format == "ndjson" && fields != nil:
+			streamNDJSON(context, project(results, fields))
+		case format == "ndjson":
+			streamNDJSON(context, results)
+		default:
+			respondResults(context, mode, results, fields)
+		}
+	}
 }
 
 func port() int {
@@ -188,6 +541,42 @@ func port() int {
 	return DefaultPort
 }
 
+// datasets returns the optional DATASETS to serve instead of the
+// DATAFILE, as a map of each dataset name to its CSV file, from a comma
+// separated list of name=file pairs e.g. "parks=parks.csv,atms=atms.csv"
+func datasets() map[string]string {
+	files := make(map[string]string)
+	datasetsStr := os.Getenv("DATASETS")
+	if datasetsStr == "" {
+		return files
+	}
+	for _, pair := range strings.Split(datasetsStr, ",") {
+		name, file, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || !validDatasetName(name) || file == "" {
+			panic(fmt.Sprintf("The environment variable DATASETS must be a comma separated list of name=file pairs, not '%s'", pair))
+		}
+		if _, exists := files[name]; exists {
+			panic(fmt.Sprintf("The dataset '%s' is in the environment variable DATASETS twice", name))
+		}
+		files[name] = file
+	}
+	return files
+}
+
+// validDatasetName checks a dataset name is safe to use in a route,
+// i.e. letters, digits, '-' and '_'
+func validDatasetName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
 func datafile() string {
 	file := os.Getenv("DATAFILE")
 	if file != "" {
@@ -196,6 +585,25 @@ func datafile() string {
 	return DefaultDataFile
 }
 
+// jobTimeout returns the optional JOB_TIMEOUT for each search
+// e.g. "500ms", with zero meaning no timeout (the default)
+func jobTimeout() time.Duration {
+	timeoutStr := os.Getenv("JOB_TIMEOUT")
+	if timeoutStr == "" {
+		return 0
+	}
+	timeout, err := time.ParseDuration(timeoutStr)
+	if err != nil || timeout < 0 {
+		panic("The environment variable JOB_TIMEOUT must be a duration e.g. 500ms")
+	}
+	return timeout
+}
+
+// flagsfile returns the optional FLAGSFILE naming the bitmap flags
+func flagsfile() string {
+	return os.Getenv("FLAGSFILE")
+}
+
 func maxResults() uint64 {
 	maxStr := os.Getenv("MAX_RESULTS")
 	if maxStr != "" {
@@ -203,18 +611,128 @@ func maxResults() uint64 {
 		if err != nil {
 			panic("Failed to parse the input integer environment variable MAX_RESULTS")
 		}
-		if maxInt > LimitMaxResults {
-			panic(fmt.Sprintf("The input integer environment variable MAX_RESULTS must be no more than %d", LimitMaxResults))
+		if maxInt == 0 || maxInt > LimitMaxResults {
+			panic(fmt.Sprintf("The input integer environment variable MAX_RESULTS must be from 1 to %d", LimitMaxResults))
 		}
 		return maxInt
 	}
 	return DefaultMaxResults
 }
 
-func units() string {
-	units := os.Getenv("UNITS")
-	if units != "mi" {
-		units = "km"
+// coordinateFormat returns the optional COORDINATE_FORMAT of the
+// imported lat and lon columns, "decimal" (the default) or "dms"
+func coordinateFormat() geodata.CoordinateFormat {
+	format, err := geodata.ParseCoordinateFormat(os.Getenv("COORDINATE_FORMAT"))
+	if err != nil {
+		panic(err)
+	}
+	return format
+}
+
+// idStrategy returns the optional ID_STRATEGY generating the IDs of
+// records without one, "line" (the default), "uuid" or "hash"
+func idStrategy() geodata.IDStrategy {
+	strategy, err := geodata.ParseIDStrategy(os.Getenv("ID_STRATEGY"))
+	if err != nil {
+		panic(err)
+	}
+	return strategy
+}
+
+// indexCache returns the optional INDEX_CACHE directory, caching the
+// index of each imported file to load on restart if it's unchanged
+func indexCache() string {
+	return os.Getenv("INDEX_CACHE")
+}
+
+// bitmapBase returns the optional BITMAP_BASE of the imported bitmaps,
+// with zero meaning decimal unless prefixed (the default)
+func bitmapBase() int {
+	baseStr := os.Getenv("BITMAP_BASE")
+	if baseStr == "" {
+		return 0
+	}
+	base, err := strconv.Atoi(baseStr)
+	if err != nil {
+		panic("The environment variable BITMAP_BASE must be 2, 8, 10 or 16")
+	}
+	return base
+}
+
+// maxCandidates returns the MAX_CANDIDATES gathered by each search
+// before sorting, a hard ceiling on the work of each search
+func maxCandidates() int {
+	candidatesStr := os.Getenv("MAX_CANDIDATES")
+	if candidatesStr != "" {
+		candidates, err := strconv.Atoi(candidatesStr)
+		if err != nil {
+			panic("Failed to parse the input integer environment variable MAX_CANDIDATES")
+		}
+		return candidates
+	}
+	return DefaultMaxCandidates
+}
+
+// distanceDecimals returns the DISTANCE_DECIMALS the result
+// distances are rounded to
+func distanceDecimals() int {
+	decimalsStr := os.Getenv("DISTANCE_DECIMALS")
+	if decimalsStr != "" {
+		decimals, err := strconv.Atoi(decimalsStr)
+		if err != nil {
+			panic("Failed to parse the input integer environment variable DISTANCE_DECIMALS")
+		}
+		return decimals
+	}
+	return geodata.DefaultDistanceDecimals
+}
+
+// snapDecimals returns the optional SNAP_DECIMALS the imported
+// coordinates are snapped to before calculating their peano codes
+func snapDecimals() (int, bool) {
+	decimalsStr := os.Getenv("SNAP_DECIMALS")
+	if decimalsStr == "" {
+		return 0, false
+	}
+	decimals, err := strconv.Atoi(decimalsStr)
+	if err != nil {
+		panic("Failed to parse the input integer environment variable SNAP_DECIMALS")
+	}
+	return decimals, true
+}
+
+// latitudeBand returns the optional LATITUDE_BAND of the records and
+// searches, as its minimum and maximum latitudes e.g. "-60,72"
+func latitudeBand() (minLat, maxLat float64, set bool) {
+	band := os.Getenv("LATITUDE_BAND")
+	if band == "" {
+		return 0, 0, false
+	}
+	minStr, maxStr, found := strings.Cut(band, ",")
+	minLat, errMin := strconv.ParseFloat(strings.TrimSpace(minStr), 64)
+	maxLat, errMax := strconv.ParseFloat(strings.TrimSpace(maxStr), 64)
+	if !found || errMin != nil || errMax != nil {
+		panic("The environment variable LATITUDE_BAND must be a minimum and maximum latitude e.g. \"-60,72\"")
+	}
+	return minLat, maxLat, true
+}
+
+func searchWidth() int {
+	widthStr := os.Getenv("SEARCH_WIDTH")
+	if widthStr != "" {
+		width, err := strconv.Atoi(widthStr)
+		if err != nil || width < 1 {
+			panic("The environment variable SEARCH_WIDTH must be a positive integer")
+		}
+		return width
+	}
+	return geodata.DefaultSearchWidth
+}
+
+func units() geodata.Units {
+	units, err := geodata.ParseUnits(os.Getenv("UNITS"))
+	if err != nil {
+		panic("The environment variable UNITS must be either \"km\" or \"mi\"")
 	}
 	return units
 }
@@ -237,28 +755,160 @@ func attachData(geo *geodata.GeoData) gin.HandlerFunc {
 	}
 }
 
-func parseParams(context *gin.Context, mode string) (lat, lon float64, bitmask uint64, err error) {
-	for k, v := range map[string]*float64{"lat": &lat, "lon": &lon} {
-		param := context.Query(k)
-		*v, err = strconv.ParseFloat(param, FloatSize)
-		if err != nil {
-			if mode != "release" {
-				log.Printf("Error converting %s '%s' to a float - %s\n", k, param, err.Error())
+// parseParams reads the query parameters accepted by the endpoint
+// into a Job, checking them against the table the schema describes
+// (see queryParams), with the default of any which weren't sent
+func parseParams(context *gin.Context, mode string, endpoint string) (job Job, err error) {
+	for _, param := range queryParams(mode) {
+		if !slices.Contains(param.Endpoints, endpoint) {
+			continue
+		}
+		value, exists := context.GetQuery(param.Name)
+		if !exists && param.Default != nil {
+			value = fmt.Sprint(param.Default)
+		} else if !exists && !param.Required {
+			continue
+		}
+		if err := param.parse(&job, value, context); err != nil {
+			return Job{}, err
+		}
+	}
+	return job, nil
+}
+
+// respond writes a 200 JSON response, indented for
+// readability unless we're in release mode
+func respond(context *gin.Context, mode string, body any) {
+	if mode != "release" {
+		context.IndentedJSON(http.StatusOK, body)
+	} else {
+		context.JSON(http.StatusOK, body)
+	}
+}
+
+// streamNDJSON writes a 200 response of newline delimited JSON,
+// one item per line, flushing each line so that clients can
+// process the results as they arrive
+func streamNDJSON[T any](context *gin.Context, items []T) {
+	context.Header("Content-Type", "application/x-ndjson")
+	context.Status(http.StatusOK)
+	encoder := json.NewEncoder(context.Writer)
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			// the client has probably gone away
+			return
+		}
+		context.Writer.Flush()
+	}
+}
+
+// The media types the search results can be sent as, chosen by the
+// Accept header, with JSON the default
+const (
+	mimeJSON    = "application/json"
+	mimeGeoJSON = "application/geo+json"
+	mimeCSV     = "text/csv"
+)
+
+// respondResults responds with the search results in the media type
+// the client accepts, as JSON (the default), GeoJSON, or CSV in the
+// import format plus the distances.  The fields apply to the JSON
+// results and the properties of the GeoJSON, but not to the CSV.
+func respondResults(context *gin.Context, mode string, results geodata.Results, fields []string) {
+	context.Writer.Header().Add("Vary", "Accept")
+	switch context.NegotiateFormat(mimeJSON, mimeGeoJSON, mimeCSV) {
+	case mimeGeoJSON:
+		collection := results.GeoJSON()
+		if fields != nil {
+			for i, properties := range project(results, fields) {
+				collection.Features[i].Properties = properties
 			}
-			// Not err.Error() here, because it would reveal system details to the user
-			return 0, 0, 0, fmt.Errorf("Error converting %s '%s' to a float", k, param)
+		}
+		context.Header("Content-Type", mimeGeoJSON)
+		respond(context, mode, collection)
+	case mimeCSV:
+		context.Header("Content-Type", mimeCSV+"; charset=utf-8")
+		context.Status(http.StatusOK)
+		if err := results.WriteCSV(context.Writer); err != nil && mode != "release" {
+			log.Printf("Failed to write CSV results - %s\n", err)
+		}
+	default:
+		if fields != nil {
+			respond(context, mode, project(results, fields))
+		} else {
+			respond(context, mode, results)
 		}
 	}
-	bitmaskStr := context.Query("bitmask")
-	bitmask, err = strconv.ParseUint(bitmaskStr, 0, BitmaskSize)
-	if err != nil {
-		if mode != "release" {
-			log.Printf("Error converting bitmask '%s' to a uint - %s\n", bitmaskStr, err.Error())
+}
+
+// parseBuckets parses the "buckets" parameter of the debug search,
+// a comma separated list of ascending distances bounding the
+// buckets of a histogram of the result distances e.g. "0.5,1,2"
+func parseBuckets(bucketsStr string) (*geodata.DistanceHistogram, error) {
+	var bounds []float64
+	for _, boundStr := range strings.Split(bucketsStr, ",") {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(boundStr), 64)
+		if err != nil || !(bound >= 0) || math.IsInf(bound, 0) || (len(bounds) > 0 && bound <= bounds[len(bounds)-1]) {
+			return nil, fmt.Errorf("Buckets '%s' must be ascending distances e.g. '0.5,1,2'", bucketsStr)
+		}
+		bounds = append(bounds, bound)
+	}
+	return &geodata.DistanceHistogram{Bounds: bounds}, nil
+}
+
+// resultFields lists the JSON keys of a geodata.ResultRecord,
+// i.e. the field names a client may request with "fields=..."
+func resultFields() map[string]bool {
+	known := make(map[string]bool)
+	rt := reflect.TypeFor[geodata.ResultRecord]()
+	for i := 0; i < rt.NumField(); i++ {
+		name, _, _ := strings.Cut(rt.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			known[name] = true
 		}
-		// Not err.Error() here, because it would reveal system details to the user
-		return 0, 0, 0, fmt.Errorf("Error converting bitmask '%s' to an integer", bitmaskStr)
 	}
-	return lat, lon, bitmask, nil
+	return known
+}
+
+// parseFields parses the comma separated "fields" parameter
+// used to project each result down to a subset of its keys,
+// e.g. fields=id,lat,lon,distance
+func parseFields(fieldsStr string) ([]string, error) {
+	known := resultFields()
+	fields := []string{}
+	for _, field := range strings.Split(fieldsStr, ",") {
+		field = strings.TrimSpace(field)
+		if !known[field] {
+			return nil, fmt.Errorf("Unknown field '%s'", field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// project cuts each result down to just the requested fields.
+// We round trip through JSON so that the field names always
+// match the JSON keys of the full response.
+func project(results geodata.Results, fields []string) []map[string]json.RawMessage {
+	projected := make([]map[string]json.RawMessage, 0, len(results))
+	for _, rec := range results {
+		encoded, err := json.Marshal(rec)
+		if err != nil {
+			panic(err)
+		}
+		var full map[string]json.RawMessage
+		if err := json.Unmarshal(encoded, &full); err != nil {
+			panic(err)
+		}
+		subset := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, exists := full[field]; exists {
+				subset[field] = value
+			}
+		}
+		projected = append(projected, subset)
+	}
+	return projected
 }
 
 func initPool(geo *geodata.GeoData, mode string) (jobs chan Job, size int) {
@@ -293,13 +943,43 @@ func processJob(geo *geodata.GeoData, job Job, mode string) {
 	lon := job.Lon
 	bitmask := job.Bitmask
 	if mode != "release" {
-		log.Printf("Searching: lat = %0.6f, lon = %0.6f, bitmask = %v\n", lat, lon, bitmask)
+		log.Printf("Searching: lat = %0.6f, lon = %0.6f, bitmask = %v, units = %s\n", lat, lon, bitmask, job.Units)
 	}
 
 	// Make the geospatial query
-	// TODO - bitmask in future might instead be a boolean logic expression...
-	res := geo.Find(lat, lon, bitmask, maxResults(), units(), mode)
+	opts := []geodata.FindOption{
+		geodata.WithRequireMask(job.Require),
+		geodata.WithExcludeMask(job.Exclude),
+		geodata.WithAtLeast(job.AtLeast),
+		geodata.WithDistanceMode(job.Distance),
+		geodata.WithRadius(job.Radius),
+		geodata.WithMinDistance(job.MinDistance),
+		geodata.WithMerge(job.Merge),
+		geodata.WithAccuracy(job.Accuracy),
+	}
+	if job.Predicate != nil {
+		opts = append(opts, geodata.WithPredicate(job.Predicate))
+	}
+	if job.Flags != nil {
+		opts = append(opts, geodata.WithFlagsMask(job.Flags))
+	}
+	if job.ExcludeFlags != nil {
+		opts = append(opts, geodata.WithExcludeFlags(job.ExcludeFlags))
+	}
+	if job.Stats != nil {
+		opts = append(opts, geodata.WithSearchStats(job.Stats))
+	}
+	if job.Histogram != nil {
+		opts = append(opts, geodata.WithDistanceHistogram(job.Histogram))
+	}
+	if job.Peanos != nil {
+		opts = append(opts, geodata.WithPeanos(job.Peanos))
+	}
+	if job.Bearings {
+		opts = append(opts, geodata.WithBearings())
+	}
+	res, err := geo.FindCtx(job.Ctx, lat, lon, bitmask, job.Max, job.Units, mode, opts...)
 
 	// post the results back to the results channel in the job
-	job.Results <- res
+	job.Results <- JobResult{Results: res, Err: err}
 }
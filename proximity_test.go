@@ -7,9 +7,20 @@ package main
 
 import (
 	"testing"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/philip-abrahamson/proximity/geodata"
 	"github.com/stretchr/testify/assert"
@@ -38,3 +49,1172 @@ func TestAPI(t *testing.T) {
 	}
 	t.Logf("%d results returned\n%v", len(results), results)
 }
+
+// Projected responses should contain exactly the requested keys
+func TestFieldProjection(t *testing.T) {
+
+	router := setupRouter()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&fields=id,lat,lon,distance", nil)
+	router.ServeHTTP(res, req)
+
+	assert := assert.New(t)
+	assert.Equal(200, res.Code, "API call returned 200")
+	var results []map[string]any
+	err := json.NewDecoder(res.Body).Decode(&results)
+	assert.Nil(err, "No JSON parsing error")
+	assert.NotEmpty(results, "Some results returned")
+	for _, rec := range results {
+		keys := []string{}
+		for k := range rec {
+			keys = append(keys, k)
+		}
+		assert.ElementsMatch([]string{"id", "lat", "lon", "distance"}, keys, "Only the requested keys returned")
+	}
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&fields=id,nonsense", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "Unknown field returned 400")
+}
+
+// A units=mi query should be honoured end to end
+func TestUnitsParam(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	search := func(query string) geodata.Results {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0"+query, nil)
+		router.ServeHTTP(res, req)
+		assert.Equal(200, res.Code, "API call returned 200")
+		var results geodata.Results
+		err := json.NewDecoder(res.Body).Decode(&results)
+		assert.Nil(err, "No JSON parsing error")
+		return results
+	}
+
+	km := search("&units=km")
+	mi := search("&units=mi")
+	assert.NotEmpty(mi, "Some results returned")
+	assert.Equal(len(km), len(mi), "Same results in either unit")
+	for i := range mi {
+		assert.Equal(geodata.Miles, mi[i].Units, "Results are in miles")
+		assert.Equal(km[i].ID, mi[i].ID, "Same ordering in either unit")
+		assert.InDelta(km[i].Distance*geodata.MilesPerDegree/geodata.KmPerDegree, mi[i].Distance, 1e-3, "Distance converted to miles, both rounded to 3 decimals")
+	}
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&units=furlongs", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "Unknown units returned 400")
+}
+
+// The distance parameter changes the distances but not the ordering
+func TestDistanceParam(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	search := func(query string) (int, geodata.Results) {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0"+query, nil)
+		router.ServeHTTP(res, req)
+		var results geodata.Results
+		json.NewDecoder(res.Body).Decode(&results)
+		return res.Code, results
+	}
+
+	_, fast := search("")
+	assert.NotEmpty(fast, "Some results returned")
+	for _, mode := range []string{"haversine", "wgs84"} {
+		code, results := search("&distance=" + mode)
+		assert.Equal(200, code, "API call returned 200")
+		assert.Equal(len(fast), len(results), "Same results with either distance")
+		for i := range results {
+			assert.Equal(fast[i].ID, results[i].ID, "Same ordering with either distance")
+			assert.InEpsilon(fast[i].Distance, results[i].Distance, 0.01, "Similar distances")
+		}
+	}
+
+	code, _ := search("&distance=manhattan")
+	assert.Equal(400, code, "Unknown distance returned 400")
+}
+
+// The max parameter limits the result count, within LimitMaxResults
+func TestMaxParam(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&max=2", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "Valid max returned 200")
+	var results geodata.Results
+	err := json.NewDecoder(res.Body).Decode(&results)
+	assert.Nil(err, "No JSON parsing error")
+	assert.Len(results, 2, "Got max results")
+
+	for _, max := range []string{"0", fmt.Sprintf("%d", LimitMaxResults+1), "-1", "two"} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&max="+max, nil)
+		router.ServeHTTP(res, req)
+		assert.Equal(400, res.Code, "Invalid max '%s' returned 400", max)
+	}
+}
+
+// The exclude parameter filters out records with any of its flags
+func TestExcludeParam(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0x3&exclude=0x2", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	var results geodata.Results
+	err := json.NewDecoder(res.Body).Decode(&results)
+	assert.Nil(err, "No JSON parsing error")
+	if assert.Len(results, 1, "Only one record has flag 1 but not flag 2") {
+		assert.Equal("ID1", results[0].ID)
+	}
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&exclude=closed", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "Invalid exclude returned 400")
+}
+
+// The mindistance parameter leaves out closer records
+func TestMinDistanceParam(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.123456&lon=-1.123456&bitmask=0&mindistance=1", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	var results geodata.Results
+	err := json.NewDecoder(res.Body).Decode(&results)
+	assert.Nil(err, "No JSON parsing error")
+	if assert.Len(results, 3, "All but the record at the search location") {
+		for _, rec := range results {
+			assert.NotEqual("ID2", rec.ID)
+			assert.GreaterOrEqual(rec.Distance, 1.0)
+		}
+	}
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.123456&lon=-1.123456&bitmask=0&mindistance=0", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "Invalid mindistance returned 400")
+}
+
+// The atleast parameter requires that many of the bitmask's flags
+func TestAtLeastParam(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0x3&atleast=2", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	var results geodata.Results
+	err := json.NewDecoder(res.Body).Decode(&results)
+	assert.Nil(err, "No JSON parsing error")
+	if assert.Len(results, 1, "Only one record has both flags") {
+		assert.Equal("ID3", results[0].ID)
+	}
+
+	for _, atLeast := range []string{"0", "65", "two"} {
+		res = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0x3&atleast="+atLeast, nil)
+		router.ServeHTTP(res, req)
+		assert.Equal(400, res.Code, "Invalid atleast '%s' returned 400", atLeast)
+	}
+}
+
+// The expr parameter replaces the bitmask with a boolean expression
+func TestExprParam(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&expr="+url.QueryEscape("(1 & 2) | !3"), nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	var results geodata.Results
+	err := json.NewDecoder(res.Body).Decode(&results)
+	assert.Nil(err, "No JSON parsing error")
+	ids := []string{}
+	for _, rec := range results {
+		ids = append(ids, rec.ID)
+	}
+	assert.ElementsMatch([]string{"ID3", "ID4"}, ids, "Records with both flags or neither")
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&expr="+url.QueryEscape("(1 & 2"), nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "Malformed expression returned 400")
+}
+
+// Named flags from the FLAGSFILE should all be required
+func TestFlagsParam(t *testing.T) {
+
+	flags := filepath.Join(t.TempDir(), "flags.csv")
+	os.WriteFile(flags, []byte("Name,Bit\nvegan,0\nindian,1\n"), 0644)
+	t.Setenv("FLAGSFILE", flags)
+	router := setupRouter()
+	assert := assert.New(t)
+
+	search := func(query string) (int, []string) {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&"+query, nil)
+		router.ServeHTTP(res, req)
+		var results geodata.Results
+		json.NewDecoder(res.Body).Decode(&results)
+		ids := []string{}
+		for _, rec := range results {
+			ids = append(ids, rec.ID)
+		}
+		return res.Code, ids
+	}
+
+	code, named := search("bitmask=0&flags=vegan,indian")
+	assert.Equal(200, code, "API call returned 200")
+	assert.Equal([]string{"ID3"}, named, "Only one record has both flags")
+	_, named = search("bitmask=0&flags=indian")
+	_, numeric := search("bitmask=2")
+	assert.Equal(numeric, named, "A single flag is the same as its bitmask")
+
+	code, _ = search("bitmask=0&flags=vegan,halal")
+	assert.Equal(400, code, "Unknown flag returned 400")
+}
+
+// Invalid coordinates should be rejected with a 400
+func TestInvalidCoordinates(t *testing.T) {
+
+	router := setupRouter()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=91.0&lon=-1.0&bitmask=0", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, 400, res.Code, "Invalid coordinates returned 400")
+
+	// ParseFloat accepts these, but they're no more valid
+	for _, query := range []string{"lat=NaN&lon=-1.0", "lat=51.5&lon=Inf", "lat=-Inf&lon=-1.0"} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/?"+query+"&bitmask=0", nil)
+		router.ServeHTTP(res, req)
+
+		assert.Equal(t, 400, res.Code, "Non-finite coordinates returned 400 for "+query)
+	}
+}
+
+// CORS preflight requests should be answered for allowed origins only
+func TestCORS(t *testing.T) {
+
+	t.Setenv("CORS_ORIGINS", "https://map.example.com, https://other.example.com")
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("OPTIONS", "/?lat=51.0&lon=-1.0&bitmask=0", nil)
+	req.Header.Set("Origin", "https://map.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "X-Requested-With")
+	router.ServeHTTP(res, req)
+	assert.Equal(204, res.Code, "Preflight returned 204")
+	assert.Equal("https://map.example.com", res.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(res.Header().Get("Access-Control-Allow-Methods"), "GET")
+	assert.Equal("X-Requested-With", res.Header().Get("Access-Control-Allow-Headers"))
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0", nil)
+	req.Header.Set("Origin", "https://other.example.com")
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "Cross-origin search returned 200")
+	assert.Equal("https://other.example.com", res.Header().Get("Access-Control-Allow-Origin"))
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("OPTIONS", "/?lat=51.0&lon=-1.0&bitmask=0", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	router.ServeHTTP(res, req)
+	assert.Equal(403, res.Code, "Preflight from a disallowed origin returned 403")
+	assert.Empty(res.Header().Get("Access-Control-Allow-Origin"))
+}
+
+// When API_KEY is set, only requests with the matching key are allowed
+func TestAPIKey(t *testing.T) {
+
+	t.Setenv("API_KEY", "s3cret")
+	router := setupRouter()
+	assert := assert.New(t)
+
+	search := func(key string, header bool) int {
+		res := httptest.NewRecorder()
+		url := "/?lat=51.0&lon=-1.0&bitmask=0"
+		if key != "" && !header {
+			url += "&api_key=" + key
+		}
+		req, _ := http.NewRequest("GET", url, nil)
+		if key != "" && header {
+			req.Header.Set("X-API-Key", key)
+		}
+		router.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	assert.Equal(401, search("", true), "Missing key returned 401")
+	assert.Equal(401, search("wrong", true), "Wrong key in a header returned 401")
+	assert.Equal(401, search("wrong", false), "Wrong key in a parameter returned 401")
+	assert.Equal(200, search("s3cret", true), "Correct key in a header returned 200")
+	assert.Equal(200, search("s3cret", false), "Correct key in a parameter returned 200")
+}
+
+// Clients exceeding RATE_LIMIT should be refused with a 429,
+// without affecting other clients
+func TestRateLimit(t *testing.T) {
+
+	t.Setenv("RATE_LIMIT", "0.001")
+	t.Setenv("RATE_BURST", "2")
+	t.Setenv("TRUSTED_PROXIES", "192.0.2.1")
+	router := setupRouter()
+	assert := assert.New(t)
+
+	search := func(client string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0", nil)
+		// all requests come via our trusted proxy
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Forwarded-For", client)
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	assert.Equal(200, search("198.51.100.1").Code, "First request in the burst returned 200")
+	assert.Equal(200, search("198.51.100.1").Code, "Second request in the burst returned 200")
+	for range 3 {
+		res := search("198.51.100.1")
+		assert.Equal(429, res.Code, "Request beyond the burst returned 429")
+		assert.NotEmpty(res.Header().Get("Retry-After"), "Retry-After header set")
+	}
+	assert.Equal(200, search("198.51.100.2").Code, "Another client behind the same proxy returned 200")
+}
+
+// Token buckets should refill at the configured rate
+func TestTokenBucket(t *testing.T) {
+
+	limiter := &rateLimiter{rate: 2, burst: 1, buckets: make(map[string]*tokenBucket), lastSweep: time.Now()}
+	now := time.Now()
+	assert := assert.New(t)
+	assert.Zero(limiter.take("client", now), "First request allowed")
+	assert.Equal(500*time.Millisecond, limiter.take("client", now), "Second request must wait for a token")
+	assert.Zero(limiter.take("client", now.Add(500*time.Millisecond)), "Request allowed once the bucket refills")
+
+	limiter.sweep(now.Add(RateLimitSweep + time.Second))
+	assert.Empty(limiter.buckets, "Idle clients swept")
+}
+
+// NDJSON responses should have one independently decodable result per line
+func TestNDJSON(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&format=ndjson", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	assert.Equal("application/x-ndjson", res.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSuffix(res.Body.String(), "\n"), "\n")
+	assert.Equal(4, len(lines), "One line per record")
+	for _, line := range lines {
+		var rec geodata.ResultRecord
+		err := json.Unmarshal([]byte(line), &rec)
+		assert.Nil(err, "Line '%s' decodes to a ResultRecord", line)
+		assert.NotEmpty(rec.ID, "Decoded record has an ID")
+	}
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&format=xml", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "Unknown format returned 400")
+}
+
+// The stats endpoint should describe the proximity.csv data
+func TestStats(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/stats", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+
+	var stats geodata.DataStats
+	err := json.NewDecoder(res.Body).Decode(&stats)
+	assert.Nil(err, "No JSON parsing error")
+	assert.Equal(geodata.DataStats{
+		RecordCount:     4,
+		DistinctPeanos1: 4,
+		DistinctPeanos2: 4,
+		LargestBucket1:  1,
+		LargestBucket2:  1,
+		Buckets1:        geodata.BucketStats{Max: 1, Mean: 1, P99: 1},
+		Buckets2:        geodata.BucketStats{Max: 1, Mean: 1, P99: 1},
+		Bounds: geodata.Bounds{
+			MinLat: 50.123456,
+			MaxLat: 52.123456,
+			MinLon: -1.123456,
+			MaxLon: 1.123456,
+		},
+	}, stats)
+}
+
+// The bounds endpoint should cover the proximity.csv data
+func TestBounds(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/bounds", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+
+	var bounds geodata.Bounds
+	err := json.NewDecoder(res.Body).Decode(&bounds)
+	assert.Nil(err, "No JSON parsing error")
+	assert.Equal(geodata.Bounds{MinLat: 50.123456, MaxLat: 52.123456, MinLon: -1.123456, MaxLon: 1.123456}, bounds)
+}
+
+// The pprof endpoints should only be served in debug mode
+func TestPprof(t *testing.T) {
+
+	assert := assert.New(t)
+	for mode, expect := range map[string]int{"debug": 200, "test": 404, "release": 404} {
+		t.Setenv("MODE", mode)
+		router := setupRouter()
+		for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap"} {
+			res := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			router.ServeHTTP(res, req)
+			assert.Equal(expect, res.Code, "%s in %s mode", path, mode)
+		}
+	}
+}
+
+// A client going away should abandon its search
+func TestClientGone(t *testing.T) {
+
+	router := setupRouter()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/?lat=51.0&lon=-1.0&bitmask=0", nil)
+	router.ServeHTTP(res, req)
+	assert.Empty(t, res.Body.String(), "No response to a client which has gone")
+}
+
+// A search taking longer than the JOB_TIMEOUT should get a 504
+func TestJobTimeout(t *testing.T) {
+
+	// no search is quicker than a nanosecond
+	t.Setenv("JOB_TIMEOUT", "1ns")
+	router := setupRouter()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusGatewayTimeout, res.Code, "Timed out search returned 504")
+}
+
+// Each of the DATASETS should be searched separately on its own route
+func TestDatasets(t *testing.T) {
+
+	dir := t.TempDir()
+	parks := filepath.Join(dir, "parks.csv")
+	os.WriteFile(parks, []byte("ID,Title,Description,URL,Bitmap,Lat,Lon\n"+
+		"PARK1,Park,A park,https://parks.example.com/1,1,51.0,-1.0\n"), 0644)
+	atms := filepath.Join(dir, "atms.csv")
+	os.WriteFile(atms, []byte("ID,Title,Description,URL,Bitmap,Lat,Lon\n"+
+		"ATM1,ATM,A cash machine,https://atms.example.com/1,1,51.0,-1.0\n"+
+		"ATM2,ATM,Another cash machine,https://atms.example.com/2,1,51.1,-1.1\n"), 0644)
+	t.Setenv("DATASETS", "parks="+parks+", atms="+atms)
+	router := setupRouter()
+	assert := assert.New(t)
+
+	search := func(path string) (int, []string) {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path+"?lat=51.0&lon=-1.0&bitmask=0", nil)
+		router.ServeHTTP(res, req)
+		var results geodata.Results
+		json.NewDecoder(res.Body).Decode(&results)
+		ids := []string{}
+		for _, rec := range results {
+			ids = append(ids, rec.ID)
+		}
+		return res.Code, ids
+	}
+
+	code, ids := search("/parks/search")
+	assert.Equal(200, code, "Parks search returned 200")
+	assert.Equal([]string{"PARK1"}, ids, "Only parks were found")
+	code, ids = search("/atms/search")
+	assert.Equal(200, code, "ATMs search returned 200")
+	assert.Equal([]string{"ATM1", "ATM2"}, ids, "Only ATMs were found")
+	code, _ = search("/")
+	assert.Equal(404, code, "The DATAFILE isn't served alongside DATASETS")
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/atms/stats", nil)
+	router.ServeHTTP(res, req)
+	var stats geodata.DataStats
+	json.NewDecoder(res.Body).Decode(&stats)
+	assert.Equal(2, stats.RecordCount, "Stats are per dataset")
+
+	t.Setenv("DATASETS", "parks="+parks+",../atms="+atms)
+	assert.Panics(func() { setupRouter() }, "Invalid dataset name panics")
+}
+
+// The debug search should report how many records it scanned
+func TestDebugSearch(t *testing.T) {
+
+	t.Setenv("MODE", "debug")
+	router := setupRouter()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/search?lat=51.0&lon=-1.0&bitmask=0", nil)
+	router.ServeHTTP(res, req)
+	assert := assert.New(t)
+	assert.Equal(200, res.Code, "Debug search returned 200")
+	var body struct {
+		Results geodata.Results     `json:"results"`
+		Stats   geodata.SearchStats `json:"stats"`
+	}
+	err := json.NewDecoder(res.Body).Decode(&body)
+	assert.Nil(err, "No JSON parsing error")
+	assert.NotEmpty(body.Results, "Results returned")
+	assert.Equal(len(body.Results), body.Stats.Results, "Stats count the results")
+	assert.GreaterOrEqual(body.Stats.Scanned, body.Stats.Results, "Scanned at least the results")
+
+	res = httptest.NewRecorder()
+	histReq, _ := http.NewRequest("GET", "/debug/search?lat=51.0&lon=-1.0&bitmask=0&buckets=1,50,100", nil)
+	router.ServeHTTP(res, histReq)
+	assert.Equal(200, res.Code, "Debug search with buckets returned 200")
+	var histBody struct {
+		Results   geodata.Results           `json:"results"`
+		Histogram geodata.DistanceHistogram `json:"histogram"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&histBody)
+	assert.Nil(err, "No JSON parsing error")
+	assert.Equal([]float64{1, 50, 100}, histBody.Histogram.Bounds)
+	total := 0
+	for _, count := range histBody.Histogram.Counts {
+		total += count
+	}
+	assert.Len(histBody.Histogram.Counts, 4, "A count per bucket and one beyond")
+	assert.Equal(len(histBody.Results), total, "The histogram counts every result")
+
+	res = httptest.NewRecorder()
+	histReq, _ = http.NewRequest("GET", "/debug/search?lat=51.0&lon=-1.0&bitmask=0&buckets=5,1", nil)
+	router.ServeHTTP(res, histReq)
+	assert.Equal(400, res.Code, "Descending buckets returned 400")
+
+	t.Setenv("MODE", "release")
+	router = setupRouter()
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(404, res.Code, "No debug search in release mode")
+}
+
+// A single record should be fetched by its ID, or 404 if there's none
+func TestRecordEndpoint(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/record/ID2", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "Found record returned 200")
+	var rec map[string]any
+	err := json.NewDecoder(res.Body).Decode(&rec)
+	assert.Nil(err, "No JSON parsing error")
+	assert.Equal("ID2", rec["id"], "Got the record with the ID")
+	assert.Equal("Second title", rec["title"], "Got the full record")
+	assert.NotContains(rec, "distance", "No distance without a search")
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/record/ID999", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(404, res.Code, "Unknown record returned 404")
+}
+
+// The MAX_CANDIDATES should limit the results of large searches
+func TestMaxCandidates(t *testing.T) {
+
+	t.Setenv("MAX_CANDIDATES", "4")
+	router := setupRouter()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&max=10", nil)
+	router.ServeHTTP(res, req)
+	assert := assert.New(t)
+	assert.Equal(200, res.Code, "API call returned 200")
+	var results geodata.Results
+	json.NewDecoder(res.Body).Decode(&results)
+	assert.LessOrEqual(len(results), 4, "No more results than candidates")
+
+	t.Setenv("MAX_CANDIDATES", "3")
+	assert.Panics(func() { setupRouter() }, "Too few candidates panics")
+}
+
+// Nothing within the radius should be an empty array with a header
+func TestRadiusExhausted(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=0.0&lon=0.0&bitmask=0&radius=10", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	assert.Equal("radius", res.Header().Get("X-Proximity-Exhausted"), "Radius exhausted header")
+	assert.JSONEq("[]", res.Body.String(), "Empty array of results")
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.123456&lon=-1.123456&bitmask=0&radius=10", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	assert.Empty(res.Header().Get("X-Proximity-Exhausted"), "No header with results")
+	var results geodata.Results
+	json.NewDecoder(res.Body).Decode(&results)
+	assert.Len(results, 1, "Only the record within the radius")
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=0.0&lon=0.0&bitmask=0&radius=-1", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "Negative radius returned 400")
+}
+
+// An envelope should nest the results alongside the query metadata
+func TestEnvelope(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=2&units=mi&max=5&envelope=true", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	var body struct {
+		Results geodata.Results `json:"results"`
+		Meta    struct {
+			Query struct {
+				Lat     float64 `json:"lat"`
+				Lon     float64 `json:"lon"`
+				Bitmask uint64  `json:"bitmask"`
+				Units   string  `json:"units"`
+				Max     uint64  `json:"max"`
+			} `json:"query"`
+			Count   int      `json:"count"`
+			Partial *bool    `json:"partial"`
+			TookMs  *float64 `json:"took_ms"`
+		} `json:"meta"`
+	}
+	err := json.NewDecoder(res.Body).Decode(&body)
+	assert.Nil(err, "No JSON parsing error")
+	assert.NotEmpty(body.Results, "Results returned")
+	assert.Equal(len(body.Results), body.Meta.Count, "Meta counts the results")
+	assert.Equal(51.0, body.Meta.Query.Lat, "Echoed lat")
+	assert.Equal(-1.0, body.Meta.Query.Lon, "Echoed lon")
+	assert.Equal(uint64(2), body.Meta.Query.Bitmask, "Echoed bitmask")
+	assert.Equal("mi", body.Meta.Query.Units, "Echoed units")
+	assert.Equal(uint64(5), body.Meta.Query.Max, "Echoed max")
+	assert.NotNil(body.Meta.Partial, "Partial flag included")
+	if assert.NotNil(body.Meta.TookMs, "Timing included") {
+		assert.GreaterOrEqual(*body.Meta.TookMs, 0.0, "Timing isn't negative")
+	}
+
+	// the bare array is still the default
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=2&envelope=false", nil)
+	router.ServeHTTP(res, req)
+	var results geodata.Results
+	assert.Nil(json.NewDecoder(res.Body).Decode(&results), "A bare array without an envelope")
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=2&envelope=true&format=ndjson", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "No envelope for ndjson")
+}
+
+// Merged results should carry a count of the records they represent
+func TestMergeParam(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&merge=1000", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	var results geodata.Results
+	json.NewDecoder(res.Body).Decode(&results)
+	if assert.Len(results, 1, "All the records merged") {
+		assert.Equal(4, results[0].Count, "Merged all the records")
+	}
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&merge=nearby", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "Invalid merge distance returned 400")
+}
+
+// An accuracy should be noted in the envelope's meta
+func TestAccuracyParam(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&accuracy=2.5&envelope=true", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	var body struct {
+		Results geodata.Results `json:"results"`
+		Meta    struct {
+			Accuracy float64 `json:"accuracy"`
+		} `json:"meta"`
+	}
+	err := json.NewDecoder(res.Body).Decode(&body)
+	assert.Nil(err, "No JSON parsing error")
+	assert.Len(body.Results, 4, "All the records found")
+	assert.Equal(2.5, body.Meta.Accuracy, "The accuracy is in the meta")
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&envelope=true", nil)
+	router.ServeHTTP(res, req)
+	assert.NotContains(res.Body.String(), "accuracy", "No accuracy without one")
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&accuracy=-1", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "Negative accuracy returned 400")
+}
+
+// The peano codes should only be returned when asked for
+func TestPeanosParam(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0", nil)
+	router.ServeHTTP(res, req)
+	assert.NotContains(res.Body.String(), "peano", "No peano codes by default")
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&peanos=true&envelope=true", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	var body struct {
+		Results geodata.Results `json:"results"`
+		Meta    struct {
+			Peanos *geodata.PeanoCodes `json:"peanos"`
+		} `json:"meta"`
+	}
+	err := json.NewDecoder(res.Body).Decode(&body)
+	assert.Nil(err, "No JSON parsing error")
+	assert.NotNil(body.Meta.Peanos, "The search codes are in the meta")
+	for _, rec := range body.Results {
+		assert.NotNil(rec.Peano1, "Each result has its first peano code")
+		assert.NotNil(rec.Peano2, "Each result has its second peano code")
+	}
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&peanos=yes", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "Invalid peanos flag returned 400")
+}
+
+// The bearings should only be returned when asked for
+func TestBearingsParam(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.123456&lon=-1.123456&bitmask=0&bearings=true", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	var results geodata.Results
+	err := json.NewDecoder(res.Body).Decode(&results)
+	assert.Nil(err, "No JSON parsing error")
+	assert.Len(results, 4)
+	for _, rec := range results {
+		if assert.NotNil(rec.Bearing, "Result %s has a bearing", rec.ID) && rec.ID == "ID3" {
+			assert.InDelta(0.0, *rec.Bearing, 0.001, "ID3 is due north")
+		}
+	}
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.123456&lon=-1.123456&bitmask=0", nil)
+	router.ServeHTTP(res, req)
+	assert.NotContains(res.Body.String(), "bearing", "No bearings by default")
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.123456&lon=-1.123456&bitmask=0&bearings=north", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "Invalid bearings flag returned 400")
+}
+
+// The schema should describe the search parameters,
+// with ranges and choices matching the validation
+func TestSchema(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/schema", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	var body struct {
+		Parameters []paramSchema `json:"parameters"`
+	}
+	err := json.NewDecoder(res.Body).Decode(&body)
+	assert.Nil(err, "No JSON parsing error")
+	params := make(map[string]paramSchema)
+	for _, param := range body.Parameters {
+		params[param.Name] = param
+	}
+	for _, name := range []string{"lat", "lon", "bitmask", "max", "units"} {
+		assert.Contains(params, name, "Schema lists "+name)
+	}
+	assert.True(params["lat"].Required, "Lat is required")
+	assert.False(params["max"].Required, "Max is optional")
+	assert.Equal("km", params["units"].Default, "Default units")
+
+	search := func(query string) int {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&"+query, nil)
+		router.ServeHTTP(res, req)
+		return res.Code
+	}
+	// every choice is accepted
+	for _, param := range body.Parameters {
+		for _, value := range param.Enum {
+			assert.Equal(200, search(param.Name+"="+value), "Accepted "+param.Name+"="+value)
+		}
+	}
+	// and the ends of the range of each integer, but no further
+	assert.NotNil(params["max"].Max, "Max has a maximum")
+	for _, param := range body.Parameters {
+		if param.Type != "integer" || param.Max == nil || !slices.Contains(param.Endpoints, "search") {
+			continue
+		}
+		min, max := int(*param.Min), int(*param.Max)
+		assert.Equal(200, search(fmt.Sprintf("%s=%d", param.Name, min)), "Accepted the smallest "+param.Name)
+		assert.Equal(200, search(fmt.Sprintf("%s=%d", param.Name, max)), "Accepted the largest "+param.Name)
+		assert.Equal(400, search(fmt.Sprintf("%s=%d", param.Name, min-1)), "Rejected a "+param.Name+" below the range")
+		assert.Equal(400, search(fmt.Sprintf("%s=%d", param.Name, max+1)), "Rejected a "+param.Name+" beyond the range")
+	}
+	// the debug parameters are listed with their endpoints
+	assert.Equal([]string{"debug/search"}, params["buckets"].Endpoints, "Buckets are only for the debug search")
+	assert.Equal([]string{"debug/curve"}, params["curve"].Endpoints, "Curve is only for the debug curve")
+	assert.Equal([]string{"search", "count", "debug/search"}, params["lat"].Endpoints, "Every search has a lat")
+}
+
+// The query subcommand should print the results of a single search
+func TestQueryCommand(t *testing.T) {
+
+	assert := assert.New(t)
+
+	var stdout, stderr bytes.Buffer
+	code := runQuery([]string{"--lat", "51.0", "--lon", "-1.0", "--mask", "2", "--max", "2"}, &stdout, &stderr)
+	assert.Equal(0, code, "Query succeeded")
+	var results geodata.Results
+	err := json.Unmarshal(stdout.Bytes(), &results)
+	assert.Nil(err, "Printed JSON results")
+	if assert.Len(results, 2, "Got the max results") {
+		assert.Equal("ID2", results[0].ID, "Nearest result matching the mask")
+		assert.NotZero(results[0].Distance, "Results have distances")
+	}
+
+	stdout.Reset()
+	code = runQuery([]string{"--lat", "51.0"}, &stdout, &stderr)
+	assert.Equal(2, code, "Missing lon is a usage error")
+	assert.Empty(stdout.String(), "Nothing printed for a usage error")
+
+	code = runQuery([]string{"--lat", "91", "--lon", "0"}, &stdout, &stderr)
+	assert.Equal(1, code, "Invalid coordinates fail the query")
+
+	stderr.Reset()
+	code = runQuery([]string{"--lat", "51.0", "--lon", "-1.0", "--file", "missing.csv"}, &stdout, &stderr)
+	assert.Equal(1, code, "A missing file fails the query")
+	assert.Contains(stderr.String(), "missing.csv", "Printed the import error")
+}
+
+// The DATAFILE can be fetched from a URL
+func TestDatafileURL(t *testing.T) {
+
+	server := httptest.NewServer(http.FileServer(http.Dir(".")))
+	defer server.Close()
+	t.Setenv("DATAFILE", server.URL+"/proximity.csv")
+	router := setupRouter()
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/record/ID3", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(t, 200, res.Code, "Record imported from the URL")
+}
+
+// With GZIP set, responses should be gzipped for clients accepting it,
+// once they reach GZIP_MIN_BYTES
+func TestGzip(t *testing.T) {
+
+	t.Setenv("GZIP", "true")
+	t.Setenv("GZIP_MIN_BYTES", "200")
+	router := setupRouter()
+	assert := assert.New(t)
+
+	search := func(path, encoding string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if encoding != "" {
+			req.Header.Set("Accept-Encoding", encoding)
+		}
+		router.ServeHTTP(res, req)
+		assert.Equal(200, res.Code, "API call returned 200")
+		return res
+	}
+
+	plain := search("/?lat=51.0&lon=-1.0&bitmask=0", "")
+	assert.Empty(plain.Header().Get("Content-Encoding"), "Not compressed without Accept-Encoding")
+	assert.Greater(plain.Body.Len(), 200, "The results are big enough to compress")
+
+	res := search("/?lat=51.0&lon=-1.0&bitmask=0", "deflate, gzip")
+	assert.Equal("gzip", res.Header().Get("Content-Encoding"))
+	assert.Equal("Accept-Encoding", res.Header().Get("Vary"))
+	reader, err := gzip.NewReader(res.Body)
+	assert.Nil(err, "The body is gzipped")
+	body, err := io.ReadAll(reader)
+	assert.Nil(err, "The body decompresses")
+	var results, expected geodata.Results
+	assert.Nil(json.Unmarshal(body, &results))
+	assert.Nil(json.Unmarshal(plain.Body.Bytes(), &expected))
+	assert.Equal(expected, results, "The decompressed results match the uncompressed ones")
+
+	// the bounds are too small to be worth compressing
+	res = search("/bounds", "gzip")
+	assert.Empty(res.Header().Get("Content-Encoding"), "Small response not compressed")
+	assert.Less(res.Body.Len(), 200)
+	assert.Contains(res.Body.String(), "min_lat")
+
+	// streamed responses are compressed as they're flushed
+	res = search("/?lat=51.0&lon=-1.0&bitmask=0&format=ndjson", "gzip")
+	assert.Equal("gzip", res.Header().Get("Content-Encoding"))
+	reader, err = gzip.NewReader(res.Body)
+	assert.Nil(err, "The streamed body is gzipped")
+	body, _ = io.ReadAll(reader)
+	assert.Equal(4, strings.Count(string(body), "\n"), "One line per record")
+
+	res = search("/?lat=51.0&lon=-1.0&bitmask=0", "gzip;q=0, identity")
+	assert.Empty(res.Header().Get("Content-Encoding"), "Not compressed when gzip is refused")
+}
+
+// The count endpoint should count the records a search
+// within the same radius finds
+func TestCount(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	for _, query := range []string{"radius=10", "radius=150", "radius=150&bitmask=2", "radius=100&units=mi&exclude=1"} {
+		if !strings.Contains(query, "bitmask") {
+			query += "&bitmask=0"
+		}
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/?lat=51.123456&lon=-1.123456&max=100&"+query, nil)
+		router.ServeHTTP(res, req)
+		var results geodata.Results
+		json.NewDecoder(res.Body).Decode(&results)
+
+		res = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/count?lat=51.123456&lon=-1.123456&"+query, nil)
+		router.ServeHTTP(res, req)
+		assert.Equal(200, res.Code, "Count returned 200 for "+query)
+		var body struct {
+			Count int `json:"count"`
+		}
+		json.NewDecoder(res.Body).Decode(&body)
+		assert.Equal(len(results), body.Count, "Count matches the search for "+query)
+	}
+
+	for _, query := range []string{"lat=51&lon=-1&bitmask=0", "lat=91&lon=-1&bitmask=0&radius=10", "lat=51&lon=-1&bitmask=0&radius=0"} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/count?"+query, nil)
+		router.ServeHTTP(res, req)
+		assert.Equal(400, res.Code, "Count returned 400 for "+query)
+	}
+}
+
+// A bitmask of comma separated hexadecimal words filters
+// across every word, for more than 64 flags
+func TestWideBitmask(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0x2,0x0", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	var results geodata.Results
+	json.NewDecoder(res.Body).Decode(&results)
+	assert.Len(results, 2, "Only the records with bit 1")
+	for _, rec := range results {
+		assert.NotZero(rec.Bitmap&2, "Record %s has bit 1", rec.ID)
+	}
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0x0,0x1", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	results = nil
+	json.NewDecoder(res.Body).Decode(&results)
+	assert.Empty(results, "No records have bit 64")
+
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0x2,xyz", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "Invalid word returned 400")
+
+	// the exclude mask can be a list of words too
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0x3&exclude=0x2,0x0", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code, "API call returned 200")
+	results = nil
+	json.NewDecoder(res.Body).Decode(&results)
+	assert.NotEmpty(results, "Found records without bit 1")
+	for _, rec := range results {
+		assert.Zero(rec.Bitmap&2, "Record %s has bit 1 excluded", rec.ID)
+	}
+}
+
+// In debug mode, the curve endpoint should list the peano codes
+// along each curve in order
+func TestDebugCurve(t *testing.T) {
+
+	t.Setenv("MODE", "debug")
+	router := setupRouter()
+	assert := assert.New(t)
+
+	for _, curve := range []string{"", "?curve=2"} {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/debug/curve"+curve, nil)
+		router.ServeHTTP(res, req)
+		assert.Equal(200, res.Code, "Debug curve returned 200")
+		var points []geodata.CurvePoint
+		err := json.NewDecoder(res.Body).Decode(&points)
+		assert.Nil(err, "No JSON parsing error")
+		assert.Len(points, 4, "A peano code per record")
+		for i := 1; i < len(points); i++ {
+			assert.Greater(points[i].Peano, points[i-1].Peano, "Sorted by peano code")
+		}
+	}
+
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/curve?curve=3", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code, "Unknown curve returned 400")
+
+	t.Setenv("MODE", "release")
+	router = setupRouter()
+	res = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/debug/curve", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(404, res.Code, "No debug curve in release mode")
+}
+
+// The results should be sent as JSON, GeoJSON or CSV
+// depending on the Accept header
+func TestAccept(t *testing.T) {
+
+	router := setupRouter()
+	assert := assert.New(t)
+
+	search := func(accept string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		router.ServeHTTP(res, req)
+		assert.Equal(200, res.Code, "API call returned 200 accepting '%s'", accept)
+		assert.Contains(res.Header().Values("Vary"), "Accept")
+		return res
+	}
+
+	for _, accept := range []string{"", "application/json", "*/*", "text/html, */*;q=0.8", "application/xml"} {
+		res := search(accept)
+		assert.Equal("application/json; charset=utf-8", res.Header().Get("Content-Type"), "JSON accepting '%s'", accept)
+		var results geodata.Results
+		err := json.NewDecoder(res.Body).Decode(&results)
+		assert.Nil(err, "No JSON parsing error")
+		assert.Len(results, 4)
+	}
+
+	res := search("application/geo+json")
+	assert.Equal("application/geo+json", res.Header().Get("Content-Type"))
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			ID       string `json:"id"`
+			Geometry struct {
+				Type        string     `json:"type"`
+				Coordinates [2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties geodata.ResultRecord `json:"properties"`
+		} `json:"features"`
+	}
+	err := json.NewDecoder(res.Body).Decode(&collection)
+	assert.Nil(err, "No GeoJSON parsing error")
+	assert.Equal("FeatureCollection", collection.Type)
+	assert.Len(collection.Features, 4)
+	for _, feature := range collection.Features {
+		assert.Equal("Point", feature.Geometry.Type)
+		assert.Equal([2]float64{feature.Properties.Lon, feature.Properties.Lat}, feature.Geometry.Coordinates)
+		assert.Equal(feature.ID, feature.Properties.ID)
+	}
+
+	res = search("text/csv, application/json;q=0.5")
+	assert.Equal("text/csv; charset=utf-8", res.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSuffix(res.Body.String(), "\n"), "\n")
+	assert.Len(lines, 5, "A header line and a line per record")
+	assert.Equal("ID,Title,Description,URL,Bitmap,Lat,Lon,Score,Distance,Units", lines[0])
+	assert.True(strings.HasSuffix(lines[1], ",km"), "Line '%s' ends with the units", lines[1])
+
+	// the format parameter takes precedence
+	res = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/?lat=51.0&lon=-1.0&bitmask=0&format=ndjson", nil)
+	req.Header.Set("Accept", "text/csv")
+	router.ServeHTTP(res, req)
+	assert.Equal("application/x-ndjson", res.Header().Get("Content-Type"))
+}